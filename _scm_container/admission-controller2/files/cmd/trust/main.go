@@ -15,25 +15,69 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	kube "admission-controller2/helpers/kube"
+	"admission-controller2/pkg/certs"
 	notaryController "admission-controller2/pkg/controller/notary"
 	"admission-controller2/pkg/kubernetes"
 	notaryClient "admission-controller2/pkg/notary"
 	registryclient "admission-controller2/pkg/registry"
+	"admission-controller2/pkg/va"
 	"admission-controller2/pkg/webhook"
 	"github.com/golang/glog"
+	"github.com/theupdateframework/notary/trustpinning"
+)
+
+var (
+	vaURL               = flag.String("va-url", "", "URL of the vulnerability scanner used to enforce va policies, va policies deny all images if unset")
+	digestCacheSize     = flag.Int("digest-cache-size", 1000, "Maximum number of verified signed digests to cache, 0 disables the cache")
+	admissionEvents     = flag.Bool("admission-events", false, "Record denied and mutated images as events on the namespace of the request")
+	digestCacheMaxAge   = flag.Duration("digest-cache-max-age", time.Minute, "Maximum time a verified signed digest is cached before trust data is fetched again")
+	addr                = flag.String("addr", webhook.DefaultAddr, "Address the webhook listens on")
+	readTimeout         = flag.Duration("read-timeout", webhook.DefaultReadTimeout, "Maximum duration for reading an admission request")
+	writeTimeout        = flag.Duration("write-timeout", webhook.DefaultWriteTimeout, "Maximum duration for writing an admission response")
+	idleTimeout         = flag.Duration("idle-timeout", webhook.DefaultIdleTimeout, "Maximum time to wait for the next request on a keep-alive connection")
+	shutdownDelay       = flag.Duration("shutdown-delay", 5*time.Second, "Time to keep serving after SIGTERM while reporting not ready, so the api server stops routing admissions to this replica")
+	certFile            = flag.String("cert-file", "/etc/certs/serverCert.pem", "File containing the webhook serving certificate")
+	keyFile             = flag.String("key-file", "/etc/certs/serverKey.pem", "File containing the webhook serving key")
+	certReloadInterval  = flag.Duration("cert-reload-interval", 30*time.Second, "How often the serving certificate is checked for changes")
+	selfManagedCerts    = flag.Bool("self-managed-certs", false, "Generate the webhook CA and serving certificate, store them in a Secret and patch the caBundle of the webhook configuration, instead of reading --cert-file and --key-file")
+	namespace           = flag.String("namespace", "ibm-system", "Namespace of the webhook service and of the Secret holding self managed certificates")
+	serviceName         = flag.String("service-name", "portieris", "Name of the webhook service the self managed serving certificate is issued for")
+	certSecret          = flag.String("cert-secret", "portieris-certs", "Name of the Secret holding self managed certificates")
+	webhookConfig       = flag.String("webhook-config", "image-admission-config", "Name of the MutatingWebhookConfiguration whose caBundle is patched with the self managed CA")
+	clientCAFile        = flag.String("client-ca-file", "", "File containing the CA bundle client certificates are verified against, client certificates are not required if unset")
+	clientSubjects      = flag.String("client-subjects", "", "Comma separated common names or subjects of client certificates allowed to call the webhook, any subject signed by the client CA is allowed if unset")
+	trustPinningFile    = flag.String("trust-pinning-file", "", "JSON file pinning the roots of notary repositories to certificate IDs by GUN or to CAs by GUN prefix, the first root fetched for a GUN is trusted if unset")
+	trustDir            = flag.String("trust-dir", "", "Directory the metadata of notary repositories is cached in, it is cached in memory if unset")
+	trustCacheSize      = flag.Int("trust-cache-size", 1000, "Maximum number of notary repositories whose metadata is cached in memory, 0 fetches it for every admission")
+	shutdownGracePeriod = flag.Duration("shutdown-grace-period", webhook.DefaultShutdownGracePeriod, "Time in-flight admissions are given to complete on shutdown")
 )
 
 func main() {
+	flag.Parse()
+
 	kubeClientset := kube.GetKubeClient()
 	kubeWrapper := kubernetes.NewKubeClientsetWrapper(kubeClientset)
-	policyClient, err := kube.GetPolicyClient()
+	policyClient, err := kube.GetPolicyInformerClient(kubeClientset)
 	if err != nil {
 		glog.Fatal("Could not get policy client", err)
 	}
+	stopCh := make(chan struct{})
+	// The informers sync in the background, the server reports not ready until they have synced
+	go func() {
+		if err := policyClient.Start(stopCh); err != nil {
+			glog.Fatal("Could not sync policy informers", err)
+		}
+	}()
 
 	ca, err := ioutil.ReadFile("/etc/certs/ca.pem")
 	if err != nil {
@@ -43,22 +87,120 @@ func main() {
 			glog.Fatal("Could not read /etc/certs/ca.pem", err)
 		}
 	}
-	trust, err := notaryClient.NewClient(".trust", ca)
+	trustPinning := trustpinning.TrustPinConfig{}
+	if *trustPinningFile != "" {
+		trustPinning, err = notaryClient.LoadTrustPinning(*trustPinningFile)
+		if err != nil {
+			glog.Fatal("Could not load trust pinning configuration", err)
+		}
+	}
+	var trust notaryClient.Interface
+	if *trustDir != "" {
+		trust, err = notaryClient.NewClient(*trustDir, ca, trustPinning)
+	} else {
+		trust, err = notaryClient.NewMemoryClient(ca, trustPinning, *trustCacheSize)
+	}
 	if err != nil {
 		glog.Fatal("Could not get trust client", err)
 	}
 
-	serverCert, err := ioutil.ReadFile("/etc/certs/serverCert.pem")
-	if err != nil {
-		glog.Fatal("Could not read /etc/certs/serverCert.pem", err)
+	var serverCert, serverKey []byte
+	var certManager *certs.Manager
+	if *selfManagedCerts {
+		certManager = certs.NewManager(kubeClientset, *namespace, *serviceName, *certSecret, *webhookConfig)
+		certificates, err := certManager.EnsureCertificates()
+		if err != nil {
+			glog.Fatal("Could not ensure webhook certificates", err)
+		}
+		serverCert, serverKey = certificates.ServerCert, certificates.ServerKey
+	} else {
+		serverCert, err = ioutil.ReadFile(*certFile)
+		if err != nil {
+			glog.Fatalf("Could not read %s: %v", *certFile, err)
+		}
+		serverKey, err = ioutil.ReadFile(*keyFile)
+		if err != nil {
+			glog.Fatalf("Could not read %s: %v", *keyFile, err)
+		}
+	}
+
+	var scanner va.Interface
+	if *vaURL != "" {
+		scanner = va.NewClient(*vaURL)
+	} else {
+		glog.Info("No vulnerability scanner configured, images with va enabled will be denied")
 	}
-	serverKey, err := ioutil.ReadFile("/etc/certs/serverKey.pem")
+
+	cr, err := registryclient.NewClient(ca)
 	if err != nil {
-		glog.Fatal("Could not read /etc/certs/serverKey.pem", err)
+		glog.Fatal("Could not get registry client", err)
 	}
+	controller := notaryController.NewController(kubeWrapper, policyClient, trust, cr, scanner)
+	controller.SetRecordEvents(*admissionEvents)
+	if *digestCacheSize > 0 {
+		digestCache, err := notaryController.NewDigestCache(*digestCacheSize, *digestCacheMaxAge)
+		if err != nil {
+			glog.Fatal("Could not create digest cache", err)
+		}
+		controller.SetDigestCache(digestCache)
 
-	cr := registryclient.NewClient()
-	controller := notaryController.NewController(kubeWrapper, policyClient, trust, cr)
-	webhook := webhook.NewServer("notary", controller, serverCert, serverKey)
-	webhook.Run()
+		// Purge the cache on SIGHUP, e.g. after a signing key is revoked
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				digestCache.Purge()
+			}
+		}()
+	}
+	opts := []webhook.Option{
+		webhook.WithAddr(*addr),
+		webhook.WithReadTimeout(*readTimeout),
+		webhook.WithWriteTimeout(*writeTimeout),
+		webhook.WithIdleTimeout(*idleTimeout),
+		webhook.WithShutdownDelay(*shutdownDelay),
+		webhook.WithShutdownGracePeriod(*shutdownGracePeriod),
+	}
+	if *clientCAFile != "" {
+		clientCA, err := ioutil.ReadFile(*clientCAFile)
+		if err != nil {
+			glog.Fatalf("Could not read %s: %v", *clientCAFile, err)
+		}
+		var subjects []string
+		for _, subject := range strings.Split(*clientSubjects, ",") {
+			if subject = strings.TrimSpace(subject); subject != "" {
+				subjects = append(subjects, subject)
+			}
+		}
+		opts = append(opts, webhook.WithClientAuth(clientCA, subjects))
+		glog.Infof("Requiring client certificates signed by %s", *clientCAFile)
+	}
+	server := webhook.NewServer("notary", controller, serverCert, serverKey, opts...)
+	server.AddReadinessCheck("policy", func() error {
+		if !policyClient.HasSynced() {
+			return errors.New("policy informers have not synced")
+		}
+		return nil
+	})
+
+	serverStopCh := make(chan struct{})
+	if certManager != nil {
+		go certManager.Run(server.SetCertificate, *certReloadInterval, serverStopCh)
+	} else {
+		go server.WatchCertificateFiles(*certFile, *keyFile, *certReloadInterval, serverStopCh)
+	}
+
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-term
+		glog.Infof("Received %v, shutting down", sig)
+		close(serverStopCh)
+	}()
+
+	if err := server.Run(serverStopCh); err != nil {
+		glog.Fatal("Webhook server failed", err)
+	}
+	close(stopCh)
+	glog.Flush()
 }
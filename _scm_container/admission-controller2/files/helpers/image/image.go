@@ -28,6 +28,8 @@ type Reference struct {
 	original string
 	name     string
 	tag      string
+	// hasTag is false if the name did not have a tag and tag is the implied latest
+	hasTag   bool
 	digest   string
 	hostname string
 	port     string
@@ -66,8 +68,9 @@ func NewReference(name string) (*Reference, error) {
 	}
 
 	// if the image does not have a tag, use `latest` so we can parse it again.
-	image := strings.Replace(name, hostname, "", 1)
-	if !strings.Contains(image, ":") {
+	// The parser tells a tag from the port of a registry such as localhost:5000
+	_, hasTag := ref.(reference.Tagged)
+	if !hasTag {
 		name += ":latest"
 	}
 
@@ -79,6 +82,7 @@ func NewReference(name string) (*Reference, error) {
 		original: original,
 		name:     ref.Name(),
 		tag:      ref.(reference.Tagged).Tag(),
+		hasTag:   hasTag,
 		digest:   digest,
 		hostname: u.Hostname(),
 		port:     u.Port(),
@@ -135,6 +139,11 @@ func (r Reference) GetTag() string {
 	return r.tag
 }
 
+// HasTag returns true if the image name has a tag, rather than the implied latest.
+func (r Reference) HasTag() bool {
+	return r.hasTag
+}
+
 // GetDigest returns the digest.
 func (r Reference) GetDigest() string {
 	return r.digest
@@ -150,6 +159,15 @@ func (r Reference) NameWithoutTag() string {
 	return r.name
 }
 
+// RepositoryPath returns the name of the repository within its registry, e.g. hello for registry.ng.bluemix.net/hello.
+func (r Reference) RepositoryPath() string {
+	host := r.hostname
+	if r.port != "" {
+		host += ":" + r.port
+	}
+	return strings.TrimPrefix(r.name, host+"/")
+}
+
 // String returns the original image name.
 func (r Reference) String() string {
 	return r.original
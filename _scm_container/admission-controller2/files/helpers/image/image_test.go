@@ -260,3 +260,46 @@ func TestReference(t *testing.T) {
 		})
 	}
 }
+
+func TestHasTag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "test.com/namespace/name", want: false},
+		{in: "test.com:8080/namespace/name", want: false},
+		{in: "test.com/namespace/name:latest", want: true},
+		{in: "test.com:8080/namespace/name:v1", want: true},
+		{in: "localhost:5000/name", want: false},
+		{in: "localhost:5000/name:v1", want: true},
+		{in: "test.com/namespace/name@sha256:0123456789abcdef", want: false},
+		{in: "test.com/namespace/name:v1@sha256:0123456789abcdef", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			image, err := NewReference(tt.in)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, image.HasTag())
+			}
+		})
+	}
+}
+
+func TestRepositoryPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "test.com/namespace/name", want: "namespace/name"},
+		{in: "test.com:8080/namespace/name:v1", want: "namespace/name"},
+		{in: "registry.ng.bluemix.net/hello@sha256:0123456789abcdef", want: "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			image, err := NewReference(tt.in)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, image.RepositoryPath())
+			}
+		})
+	}
+}
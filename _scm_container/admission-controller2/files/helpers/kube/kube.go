@@ -15,6 +15,8 @@
 package kube
 
 import (
+	"time"
+
 	securityenforcementclientset "admission-controller2/pkg/apis/securityenforcement/client/clientset/versioned"
 	"admission-controller2/pkg/policy"
 	"github.com/golang/glog"
@@ -22,6 +24,9 @@ import (
 	"k8s.io/client-go/rest"
 )
 
+// policyResyncPeriod is how often the policy informers resync their caches, the informers watch for changes so this is only a safety net
+const policyResyncPeriod = 10 * time.Minute
+
 // GetKubeClient creates a kube clientset
 func GetKubeClient() *kubernetes.Clientset {
 	config, err := rest.InClusterConfig()
@@ -35,8 +40,27 @@ func GetKubeClient() *kubernetes.Clientset {
 	return clientset
 }
 
-// GetPolicyClient creates a policy clientset
-func GetPolicyClient() (*policy.Client, error) {
+// GetPolicyClient creates a policy clientset, the kube clientset is used to retrieve namespace labels
+func GetPolicyClient(kubeClientset kubernetes.Interface) (*policy.Client, error) {
+	// Get configuration
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get admission policy clientset
+	clientset, err := securityenforcementclientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	policyClient := policy.NewClient(clientset, kubeClientset)
+	return policyClient, nil
+}
+
+// GetPolicyInformerClient creates a policy client backed by shared informers, it must be started before use
+// The kube clientset is used to watch namespaces for their labels
+func GetPolicyInformerClient(kubeClientset kubernetes.Interface) (*policy.InformerClient, error) {
 	// Get configuration
 	cfg, err := rest.InClusterConfig()
 	if err != nil {
@@ -49,6 +73,6 @@ func GetPolicyClient() (*policy.Client, error) {
 		return nil, err
 	}
 
-	policyClient := policy.NewClient(clientset)
+	policyClient := policy.NewInformerClient(clientset, kubeClientset, policyResyncPeriod)
 	return policyClient, nil
 }
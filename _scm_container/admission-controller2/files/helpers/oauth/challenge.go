@@ -0,0 +1,174 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Challenge is a Bearer authentication challenge from a WWW-Authenticate header
+// as described by the Docker Registry v2 token authentication specification
+type Challenge struct {
+	Realm   string
+	Service string
+	Scope   string
+}
+
+// GetChallenge probes the /v2/ endpoint of a registry or notary server for its authentication challenge
+// It returns nil without an error if the server does not ask for Bearer authentication,
+// and an error if the server cannot be reached, e.g. because its certificate is not trusted by httpClient
+func GetChallenge(httpClient *http.Client, serverURL string) (*Challenge, error) {
+	resp, err := httpClient.Get(strings.TrimSuffix(serverURL, "/") + "/v2/")
+	if err != nil {
+		glog.Errorf("Error probing %s for an authentication challenge: %v", serverURL, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, nil
+	}
+	for _, header := range resp.Header[http.CanonicalHeaderKey("WWW-Authenticate")] {
+		if challenge, ok := ParseChallenge(header); ok {
+			return challenge, nil
+		}
+	}
+	return nil, nil
+}
+
+// ParseChallenge parses a WWW-Authenticate header value, returning false if it is not a Bearer challenge with a realm
+// e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"
+func ParseChallenge(header string) (*Challenge, bool) {
+	header = strings.TrimSpace(header)
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	s := header[len("Bearer "):]
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+		eq := strings.Index(s, "=")
+		if eq <= 0 {
+			return nil, false
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			// Quoted values may contain commas and backslash escaped characters
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, false
+			}
+			value = b.String()
+			s = s[i+1:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+
+	if params["realm"] == "" {
+		return nil, false
+	}
+	return &Challenge{
+		Realm:   params["realm"],
+		Service: params["service"],
+		Scope:   params["scope"],
+	}, true
+}
+
+// RequestWithChallenge gets a token for the repo from the realm of the challenge using basic auth
+// Anonymous tokens are requested if username and password are empty
+func RequestWithChallenge(httpClient *http.Client, challenge *Challenge, token string, repo string, username string, writeAccessRequired bool) (*TokenResponse, error) {
+	var actions string
+	if writeAccessRequired {
+		actions = "pull,push,*"
+	} else {
+		actions = "pull"
+	}
+
+	realm, err := url.Parse(challenge.Realm)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid authentication realm %q: %v", challenge.Realm, err)
+	}
+	query := realm.Query()
+	if challenge.Service != "" {
+		query.Set("service", challenge.Service)
+	}
+	// The scope of the challenge is for whatever the probe asked for, the token must be for the repo
+	query.Set("scope", "repository:"+repo+":"+actions)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" || token != "" {
+		req.SetBasicAuth(username, token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		glog.Errorf("Error sending request to token server: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		glog.Errorf("Received non-success status code %v", resp.StatusCode)
+		return nil, fmt.Errorf("Request to token server failed with status code: %v and body: %s", resp.StatusCode, body)
+	}
+
+	tokenResponse := TokenResponse{}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshall token response: %s", err)
+	}
+	// Token servers may return the token in either field, notary reads token
+	if tokenResponse.Token == "" {
+		tokenResponse.Token = tokenResponse.AccessToken
+	}
+	if tokenResponse.Token == "" {
+		return nil, fmt.Errorf("Token server returned an empty token")
+	}
+
+	return &tokenResponse, nil
+}
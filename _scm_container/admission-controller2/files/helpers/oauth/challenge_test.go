@@ -0,0 +1,111 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   *Challenge
+	}{
+		{
+			name:   "parses a challenge with all parameters",
+			header: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull,push"`,
+			want: &Challenge{
+				Realm:   "https://auth.docker.io/token",
+				Service: "registry.docker.io",
+				Scope:   "repository:library/nginx:pull,push",
+			},
+		},
+		{
+			name:   "parses unquoted values and spaces between parameters",
+			header: `bearer realm=https://notary.test.com/auth, service=notary`,
+			want: &Challenge{
+				Realm:   "https://notary.test.com/auth",
+				Service: "notary",
+			},
+		},
+		{
+			name:   "unescapes quoted values",
+			header: `Bearer realm="https://test.com/token",service="a \"quoted\" service"`,
+			want: &Challenge{
+				Realm:   "https://test.com/token",
+				Service: `a "quoted" service`,
+			},
+		},
+		{
+			name:   "rejects basic challenges",
+			header: `Basic realm="registry"`,
+		},
+		{
+			name:   "rejects challenges without a realm",
+			header: `Bearer service="registry.docker.io"`,
+		},
+		{
+			name:   "rejects unterminated quoted values",
+			header: `Bearer realm="https://test.com/token`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, ok := ParseChallenge(tt.header)
+			assert.Equal(t, tt.want != nil, ok)
+			assert.Equal(t, tt.want, challenge)
+		})
+	}
+}
+
+func TestRequestWithChallenge(t *testing.T) {
+	var scope string
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope = r.URL.Query().Get("scope")
+		fmt.Fprint(w, `{"token": "token"}`)
+	}))
+	defer tokenServer.Close()
+
+	tests := []struct {
+		name      string
+		challenge *Challenge
+		wantScope string
+	}{
+		{
+			name:      "requests pull access to the repo",
+			challenge: &Challenge{Realm: tokenServer.URL},
+			wantScope: "repository:test.com/namespace/name:pull",
+		},
+		{
+			name:      "ignores the scope of the challenge",
+			challenge: &Challenge{Realm: tokenServer.URL, Scope: "repository:test.com/namespace/other:pull"},
+			wantScope: "repository:test.com/namespace/name:pull",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := RequestWithChallenge(http.DefaultClient, tt.challenge, "secret", "test.com/namespace/name", "user", false)
+			assert.NoError(t, err)
+			assert.Equal(t, "token", token.Token)
+			assert.Equal(t, tt.wantScope, scope)
+		})
+	}
+}
@@ -15,6 +15,8 @@
 package oauth
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -26,21 +28,38 @@ import (
 	"github.com/golang/glog"
 )
 
-var client = &http.Client{
-	Timeout: 10 * time.Minute,
-	Transport: &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout:   5 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).Dial,
-		DisableKeepAlives:   false,
-		MaxIdleConnsPerHost: 10,
-		TLSHandshakeTimeout: 5 * time.Second,
-	},
+// NewHTTPClient returns a client for token and notary servers that trusts customCA as well as the system pool
+func NewHTTPClient(customCA []byte) (*http.Client, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, err
+	}
+	if customCA != nil {
+		rootCAs.AppendCertsFromPEM(customCA)
+	}
+	return newHTTPClient(rootCAs), nil
+}
+
+// newHTTPClient returns a client that verifies servers against rootCAs, or the system pool if it is nil
+func newHTTPClient(rootCAs *x509.CertPool) *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Minute,
+		Transport: &http.Transport{
+			Dial: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).Dial,
+			DisableKeepAlives:   false,
+			MaxIdleConnsPerHost: 10,
+			TLSHandshakeTimeout: 5 * time.Second,
+			TLSClientConfig:     &tls.Config{RootCAs: rootCAs},
+		},
+	}
 }
 
 // Request is a helper for getting an OAuth token from the Registry OAuth Service.
 // Takes the following as input:
+//   httpClient          - Client used to reach the OAuth service, e.g. one from NewHTTPClient that trusts a custom CA
 //   token               - Auth token being used for the request
 //   repo                - Repo you are requesting access too e.g. bainsy88/busybox
 //   username            - Username for the OAuth request, identifies the type of token being passed in. Valid usernames are token (for registry token), iambearer, iamapikey, bearer (UAA bearer (legacy)), iamrefresh
@@ -51,7 +70,7 @@ var client = &http.Client{
 //   *auth.TokenResponse - Details of the type is here https://github.ibm.com/alchemy-registry/registry-types/tree/master/auth#type-tokenresponse
 //                         Token is the element you will need to forward to the registry/notary as part of a Bearer Authorization Header
 //   error
-func Request(token string, repo string, username string, writeAccessRequired bool, service string, hostname string) (*TokenResponse, error) {
+func Request(httpClient *http.Client, token string, repo string, username string, writeAccessRequired bool, service string, hostname string) (*TokenResponse, error) {
 	var actions string
 	//If you want to verify if a the credential supplied has read and write access to the repo we ask oauth for pull,push and *
 	if writeAccessRequired {
@@ -60,7 +79,7 @@ func Request(token string, repo string, username string, writeAccessRequired boo
 		actions = "pull"
 	}
 
-	resp, err := client.PostForm(hostname+"/oauth/token", url.Values{
+	resp, err := httpClient.PostForm(hostname+"/oauth/token", url.Values{
 		"service":    {service},
 		"grant_type": {"password"},
 		"client_id":  {"testclient"},
@@ -15,6 +15,8 @@
 package v1beta1
 
 import (
+	"fmt"
+	"path"
 	"strings"
 
 	"admission-controller2/helpers/wildcard"
@@ -81,129 +83,244 @@ type ClusterImagePolicyList struct {
 // PolicySpec is the spec for a ImagePolicy or ClusterImagePolicy resource
 type PolicySpec struct {
 	Repositories []Repository `json:"repositories"`
+	// Overridable is only used by ClusterImagePolicies, if it is false the policy is a floor that ImagePolicies can only make stricter.
+	// The default is true, a namespace with ImagePolicies does not use ClusterImagePolicies.
+	Overridable *bool `json:"overridable,omitempty"`
+	// NamespaceSelector is only used by ClusterImagePolicies, the policy only applies in namespaces whose labels match it.
+	// The default applies the policy in every namespace.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// ObjectSelector is only used by ClusterImagePolicies, the policy only applies to objects whose labels match it, e.g. the labels of a Deployment rather than its pod template.
+	// The default applies the policy to every object.
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+}
+
+// IsOverridable returns true if ImagePolicies replace the policy rather than only making it stricter
+func (s PolicySpec) IsOverridable() bool {
+	return s.Overridable == nil || *s.Overridable
 }
 
 // Repository .
 type Repository struct {
 	Name   string `json:"name,omitempty"` // Name may contain a * to signify one or more characters
 	Policy Policy `json:"policy,omitempty"`
+	// Deny denies images from the repository, e.g. to block a registry that a broader repository allows.
+	// A deny wins over an allow whose name matches the image as closely.
+	Deny bool `json:"deny,omitempty"`
+	// Message is added to the denial of an image from a repository that is denied
+	Message string `json:"message,omitempty"`
 }
 
+// Enforcement modes of a policy
+const (
+	// EnforcementModeEnforce denies images that fail the policy
+	EnforcementModeEnforce = "enforce"
+	// EnforcementModeWarn allows images that fail the policy, records the failure and warns the user
+	EnforcementModeWarn = "warn"
+	// EnforcementModeAudit allows images that fail the policy and records the failure
+	EnforcementModeAudit = "audit"
+)
+
 // Policy .
 type Policy struct {
 	Trust Trust `json:"trust,omitempty"`
 	Va    VA    `json:"va,omitempty"`
+	Tags  Tags  `json:"tags,omitempty"`
+	// EnforcementMode is enforce, warn or audit, the default is enforce
+	EnforcementMode string `json:"enforcementMode,omitempty"`
+}
+
+// GetEnforcementMode returns the enforcement mode of the policy
+// Policies without a mode, or with a mode that is not recognised, are enforced
+func (p Policy) GetEnforcementMode() string {
+	switch strings.ToLower(p.EnforcementMode) {
+	case EnforcementModeWarn:
+		return EnforcementModeWarn
+	case EnforcementModeAudit:
+		return EnforcementModeAudit
+	default:
+		return EnforcementModeEnforce
+	}
 }
 
 // Trust .
 type Trust struct {
-	Enabled       *bool    `json:"enabled,omitempty"`
+	Enabled *bool `json:"enabled,omitempty"`
+	// SignerSecrets are signers that must all have signed the image
 	SignerSecrets []Signer `json:"signerSecrets,omitempty"`
-	TrustServer   string   `json:"trustServer,omitempty"`
+	// SignerGroups are groups of signers of which a minimum number must have signed the image
+	SignerGroups []SignerGroup `json:"signerGroups,omitempty"`
+	TrustServer  string        `json:"trustServer,omitempty"`
 }
 
-// Signer .
+// Signer is a signer whose public key is in a Secret, in a ConfigMap, or inline in the policy
+// A Secret or ConfigMap has the name of the signer in its name key and its PEM public key in its publicKey key
+// The public key may be a bundle of PEM public keys, a signature made with any of them is accepted so that keys can be rotated.
+// A key with a Not-After PEM header holding an RFC 3339 time is no longer accepted after that time.
 type Signer struct {
-	Name string `json:"name"`
+	// Name is the name of a Secret that holds the signer
+	Name string `json:"name,omitempty"`
+	// ConfigMap is the name of a ConfigMap that holds the signer, instead of a Secret
+	ConfigMap string `json:"configMap,omitempty"`
+	// Namespace is the namespace of the Secret or ConfigMap, the default is the namespace of the workload.
+	// Only ClusterImagePolicies may refer to another namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// SignerName and PublicKey specify the signer inline, SignerName is the name of its delegation role e.g. releases and PublicKey is its PEM public key
+	SignerName string `json:"signerName,omitempty"`
+	PublicKey  string `json:"publicKey,omitempty"`
+}
+
+// String describes where the signer is specified
+func (s Signer) String() string {
+	switch {
+	case s.PublicKey != "":
+		return fmt.Sprintf("inline signer %s", s.SignerName)
+	case s.ConfigMap != "":
+		return fmt.Sprintf("configmap %s", path.Join(s.Namespace, s.ConfigMap))
+	default:
+		return fmt.Sprintf("secret %s", path.Join(s.Namespace, s.Name))
+	}
+}
+
+// SignerGroup is a group of signers, e.g. release engineers, of which at least Threshold must have signed the same digest
+type SignerGroup struct {
+	SignerSecrets []Signer `json:"signerSecrets"`
+	// Threshold is the minimum number of the signers that must have signed, the default is all of them
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// GetThreshold returns the number of the signers in the group that must have signed, by default all of the distinct signers
+func (g SignerGroup) GetThreshold() int {
+	if g.Threshold <= 0 {
+		return len(g.DistinctSignerSecrets())
+	}
+	return g.Threshold
+}
+
+// DistinctSignerSecrets returns the signers of the group with duplicates removed, a signer listed twice only signs once
+func (g SignerGroup) DistinctSignerSecrets() []Signer {
+	var signers []Signer
+	seen := map[Signer]bool{}
+	for _, signer := range g.SignerSecrets {
+		if !seen[signer] {
+			seen[signer] = true
+			signers = append(signers, signer)
+		}
+	}
+	return signers
+}
+
+// Tags .
+type Tags struct {
+	// Allowed are patterns, which may contain a * to signify any characters, one of which the tag of an image must match, e.g. v*.*.*
+	// The default allows every tag
+	Allowed []string `json:"allowed,omitempty"`
+	// Forbidden are patterns that the tag of an image must not match, e.g. latest. An image without a tag has the tag latest.
+	Forbidden []string `json:"forbidden,omitempty"`
+	// RequireDigest denies images that are not specified by digest
+	RequireDigest bool `json:"requireDigest,omitempty"`
 }
 
 // VA .
 type VA struct {
 	Enabled *bool `json:"enabled,omitempty"`
+	// Threshold is the lowest severity of vulnerability (low, medium, high or critical) that causes an image to be denied, the default is high
+	Threshold string `json:"threshold,omitempty"`
+	// Exemptions are the IDs of vulnerabilities that are ignored, e.g. CVE-2018-1234
+	Exemptions []string `json:"exemptions,omitempty"`
 }
 
-// FindImagePolicy - Given an ImagePolicyList, find the repository whose name
-// most closely matches the image name, and returns its policy.
-// If there are no matches, return a nil value.
-func (apl ImagePolicyList) FindImagePolicy(image string) *Policy {
-	// Variables
-	bestMatchQuality := -1
-	bestMatchedPolicy := Policy{}
+// Kinds of the policy resources
+const (
+	ImagePolicyKind        = "ImagePolicy"
+	ClusterImagePolicyKind = "ClusterImagePolicy"
+)
 
-	// Check if there are policies for the given image
-Exact:
-	for _, item := range apl.Items {
+// PolicyMatch is the policy found for an image, with the policy resource and repository that it came from
+// +k8s:deepcopy-gen=false
+type PolicyMatch struct {
+	Policy
+	// Kind is ImagePolicy or ClusterImagePolicy
+	Kind string
+	// Namespace is the namespace of an ImagePolicy, it is empty for a ClusterImagePolicy
+	Namespace string
+	Name      string
+	// Pattern is the name of the repository that matched the image
+	Pattern string
+	// Quality is the length of the image for an exact match, or the number of characters in the pattern that are not wildcards
+	Quality int
+	// Overridable is true if the policy may be replaced by an ImagePolicy rather than only made stricter
+	Overridable bool
+	// Floor is the ClusterImagePolicy that the policy was made at least as strict as, nil if there is none
+	Floor *PolicyMatch
+	// Deny is true if the matching repository denies the image, Message is the reason it gave
+	Deny    bool
+	Message string
+}
 
-		// iterate over the repositories
-		for _, repo := range item.Spec.Repositories {
-
-			// get the name for the current repository
-			repositoryName := repo.Name
-			hasWildcard := strings.Contains(repositoryName, "*")
-			// glog.Infof("repositoryName: %s", repositoryName)
-
-			// Check if the image name matches the repository name
-			match := false
-			matchQuality := -1
-			if !hasWildcard && repositoryName == image {
-				// glog.Info("Found exact match")
-				bestMatchQuality = len(image)
-				bestMatchedPolicy = repo.Policy
-				break Exact
-			} else {
-				if wildcard.CompareAnyTag(repositoryName, image) {
-					match = true
-					matchQuality = len(repositoryName) - strings.Count(repositoryName, "*")
-				}
-			}
-			// glog.Infof("match: %t  matchQuality: %d", match, matchQuality)
-			if match == true && matchQuality > bestMatchQuality {
-				// glog.Info("Updating to this match")
-				bestMatchQuality = matchQuality
-				bestMatchedPolicy = repo.Policy
+// String describes where the policy came from, e.g. ClusterImagePolicy default repository "*"
+func (m PolicyMatch) String() string {
+	name := m.Name
+	if m.Namespace != "" {
+		name = m.Namespace + "/" + m.Name
+	}
+	description := fmt.Sprintf("%s %s repository %q", m.Kind, name, m.Pattern)
+	if m.Floor != nil {
+		description = fmt.Sprintf("%s with floor %s", description, m.Floor)
+	}
+	return description
+}
+
+// matchRepositories compares the image to the repositories of a policy resource, and returns the closest of them and best
+// A repository that denies the image wins over one that matches as closely and allows it
+// It also returns true if a repository name is exactly the image and denies it, no other repository can match more closely
+func matchRepositories(best *PolicyMatch, kind, namespace, name string, spec PolicySpec, image string) (*PolicyMatch, bool) {
+	overridable := spec.IsOverridable()
+	for _, repo := range spec.Repositories {
+		// get the name for the current repository
+		repositoryName := repo.Name
+		hasWildcard := strings.Contains(repositoryName, "*")
+
+		// Check if the image name matches the repository name
+		matchQuality := -1
+		if !hasWildcard && repositoryName == image {
+			matchQuality = len(image)
+		} else if wildcard.CompareAnyTag(repositoryName, image) {
+			matchQuality = len(repositoryName) - strings.Count(repositoryName, "*")
+		}
+		if matchQuality > -1 && (best == nil || matchQuality > best.Quality || (matchQuality == best.Quality && repo.Deny && !best.Deny)) {
+			best = &PolicyMatch{Policy: repo.Policy, Kind: kind, Namespace: namespace, Name: name, Pattern: repositoryName, Quality: matchQuality, Overridable: overridable, Deny: repo.Deny, Message: repo.Message}
+			if matchQuality == len(image) && repo.Deny {
+				return best, true
 			}
 		}
 	}
-	if bestMatchQuality > -1 {
-		return &bestMatchedPolicy
+	return best, false
+}
+
+// FindImagePolicy - Given an ImagePolicyList, find the repository whose name
+// most closely matches the image name, and returns its policy and where it came from.
+// If there are no matches, return a nil value.
+func (apl ImagePolicyList) FindImagePolicy(image string) *PolicyMatch {
+	var best *PolicyMatch
+	for _, item := range apl.Items {
+		var exact bool
+		if best, exact = matchRepositories(best, ImagePolicyKind, item.Namespace, item.Name, item.Spec, image); exact {
+			break
+		}
 	}
-	return nil
+	return best
 }
 
 // FindClusterImagePolicy - Given an ClusterImagePolicyList, find the repository whose name
-// most closely matches the image name, and returns its policy.
+// most closely matches the image name, and returns its policy and where it came from.
 // If there are no matches, return a nil value.
-func (apl ClusterImagePolicyList) FindClusterImagePolicy(image string) *Policy {
-	// Variables
-	bestMatchQuality := -1
-	bestMatchedPolicy := Policy{}
-
-	// Check if there are policies for the given image
-Exact:
+func (apl ClusterImagePolicyList) FindClusterImagePolicy(image string) *PolicyMatch {
+	var best *PolicyMatch
 	for _, item := range apl.Items {
-
-		// iterate over the repositories
-		for _, repo := range item.Spec.Repositories {
-
-			// get the name for the current repository
-			repositoryName := repo.Name
-			hasWildcard := strings.Contains(repositoryName, "*")
-			// glog.Infof("repositoryName: %s", repositoryName)
-
-			// Check if the image name matches the repository name
-			match := false
-			matchQuality := -1
-			if !hasWildcard && repositoryName == image {
-				// glog.Info("Found exact match")
-				bestMatchQuality = len(image)
-				bestMatchedPolicy = repo.Policy
-				break Exact
-			} else {
-				if wildcard.CompareAnyTag(repositoryName, image) {
-					match = true
-					matchQuality = len(repositoryName) - strings.Count(repositoryName, "*")
-				}
-			}
-			// glog.Infof("match: %t  matchQuality: %d", match, matchQuality)
-			if match == true && matchQuality > bestMatchQuality {
-				// glog.Info("Updating to this match")
-				bestMatchQuality = matchQuality
-				bestMatchedPolicy = repo.Policy
-			}
+		var exact bool
+		if best, exact = matchRepositories(best, ClusterImagePolicyKind, "", item.Name, item.Spec, image); exact {
+			break
 		}
 	}
-	if bestMatchQuality > -1 {
-		return &bestMatchedPolicy
-	}
-	return nil
+	return best
 }
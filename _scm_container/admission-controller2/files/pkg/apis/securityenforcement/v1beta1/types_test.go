@@ -19,6 +19,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("Types", func() {
@@ -482,4 +483,112 @@ var _ = Describe("Types", func() {
 			})
 		})
 	})
+
+	Describe("GetEnforcementMode", func() {
+		It("should enforce a policy without a mode", func() {
+			Expect(Policy{}.GetEnforcementMode()).To(Equal(EnforcementModeEnforce))
+		})
+		It("should return the mode of the policy", func() {
+			Expect(Policy{EnforcementMode: "warn"}.GetEnforcementMode()).To(Equal(EnforcementModeWarn))
+			Expect(Policy{EnforcementMode: "Audit"}.GetEnforcementMode()).To(Equal(EnforcementModeAudit))
+		})
+		It("should enforce a policy with an unknown mode", func() {
+			Expect(Policy{EnforcementMode: "dryrun"}.GetEnforcementMode()).To(Equal(EnforcementModeEnforce))
+		})
+	})
+
+	Describe("Signer String", func() {
+		It("should describe where the signer is specified", func() {
+			Expect(Signer{Name: "signer"}.String()).To(Equal("secret signer"))
+			Expect(Signer{Name: "signer", Namespace: "signers"}.String()).To(Equal("secret signers/signer"))
+			Expect(Signer{ConfigMap: "signer", Namespace: "signers"}.String()).To(Equal("configmap signers/signer"))
+			Expect(Signer{SignerName: "releases", PublicKey: "key"}.String()).To(Equal("inline signer releases"))
+		})
+	})
+
+	Describe("SignerGroup GetThreshold", func() {
+		It("should require every signer without a threshold", func() {
+			Expect(SignerGroup{SignerSecrets: []Signer{{Name: "a"}, {Name: "b"}}}.GetThreshold()).To(Equal(2))
+		})
+		It("should require every distinct signer without a threshold", func() {
+			Expect(SignerGroup{SignerSecrets: []Signer{{Name: "a"}, {Name: "b"}, {Name: "a"}}}.GetThreshold()).To(Equal(2))
+		})
+		It("should return the threshold of the group", func() {
+			Expect(SignerGroup{SignerSecrets: []Signer{{Name: "a"}, {Name: "b"}}, Threshold: 1}.GetThreshold()).To(Equal(1))
+		})
+	})
+
+	Describe("when a repository matches", func() {
+		It("should return where the policy came from", func() {
+			apl := ClusterImagePolicyList{
+				Items: []ClusterImagePolicy{
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "default"},
+						Spec: PolicySpec{
+							Repositories: []Repository{{Name: "*"}, {Name: "test.com/*"}},
+						},
+					},
+				},
+			}
+			match := apl.FindClusterImagePolicy("test.com/hello")
+			Expect(match).ToNot(BeNil())
+			Expect(match.Kind).To(Equal(ClusterImagePolicyKind))
+			Expect(match.Pattern).To(Equal("test.com/*"))
+			Expect(match.Quality).To(Equal(9))
+			Expect(match.String()).To(Equal(`ClusterImagePolicy default repository "test.com/*"`))
+		})
+	})
+
+	Describe("when a repository denies the image", func() {
+		It("should deny an image the closest repository denies", func() {
+			apl := ImagePolicyList{
+				Items: []ImagePolicy{
+					{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "allow"},
+						Spec:       PolicySpec{Repositories: []Repository{{Name: "*"}}},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "block-docker-hub"},
+						Spec:       PolicySpec{Repositories: []Repository{{Name: "docker.io/*", Deny: true, Message: "use the internal mirror"}}},
+					},
+				},
+			}
+			match := apl.FindImagePolicy("docker.io/nginx")
+			Expect(match).ToNot(BeNil())
+			Expect(match.Deny).To(BeTrue())
+			Expect(match.Message).To(Equal("use the internal mirror"))
+			Expect(match.Name).To(Equal("block-docker-hub"))
+		})
+		It("should allow an image a closer repository allows", func() {
+			apl := ImagePolicyList{
+				Items: []ImagePolicy{
+					{
+						Spec: PolicySpec{Repositories: []Repository{{Name: "docker.io/*", Deny: true}, {Name: "docker.io/library/*"}}},
+					},
+				},
+			}
+			match := apl.FindImagePolicy("docker.io/library/nginx")
+			Expect(match).ToNot(BeNil())
+			Expect(match.Deny).To(BeFalse())
+			Expect(match.Pattern).To(Equal("docker.io/library/*"))
+		})
+		It("should deny an image when an allow and a deny match as closely", func() {
+			apl := ClusterImagePolicyList{
+				Items: []ClusterImagePolicy{
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "allow"},
+						Spec:       PolicySpec{Repositories: []Repository{{Name: "docker.io/nginx"}}},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{Name: "deny"},
+						Spec:       PolicySpec{Repositories: []Repository{{Name: "docker.io/nginx", Deny: true}}},
+					},
+				},
+			}
+			match := apl.FindClusterImagePolicy("docker.io/nginx")
+			Expect(match).ToNot(BeNil())
+			Expect(match.Deny).To(BeTrue())
+			Expect(match.Name).To(Equal("deny"))
+		})
+	})
 })
@@ -21,6 +21,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -149,6 +150,7 @@ func (in *Policy) DeepCopyInto(out *Policy) {
 	*out = *in
 	in.Trust.DeepCopyInto(&out.Trust)
 	in.Va.DeepCopyInto(&out.Va)
+	in.Tags.DeepCopyInto(&out.Tags)
 	return
 }
 
@@ -172,6 +174,33 @@ func (in *PolicySpec) DeepCopyInto(out *PolicySpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Overridable != nil {
+		in, out := &in.Overridable, &out.Overridable
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(bool)
+			**out = **in
+		}
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.LabelSelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.ObjectSelector != nil {
+		in, out := &in.ObjectSelector, &out.ObjectSelector
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(v1.LabelSelector)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -218,6 +247,53 @@ func (in *Signer) DeepCopy() *Signer {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SignerGroup) DeepCopyInto(out *SignerGroup) {
+	*out = *in
+	if in.SignerSecrets != nil {
+		in, out := &in.SignerSecrets, &out.SignerSecrets
+		*out = make([]Signer, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SignerGroup.
+func (in *SignerGroup) DeepCopy() *SignerGroup {
+	if in == nil {
+		return nil
+	}
+	out := new(SignerGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Tags) DeepCopyInto(out *Tags) {
+	*out = *in
+	if in.Allowed != nil {
+		in, out := &in.Allowed, &out.Allowed
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Forbidden != nil {
+		in, out := &in.Forbidden, &out.Forbidden
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tags.
+func (in *Tags) DeepCopy() *Tags {
+	if in == nil {
+		return nil
+	}
+	out := new(Tags)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Trust) DeepCopyInto(out *Trust) {
 	*out = *in
@@ -235,6 +311,13 @@ func (in *Trust) DeepCopyInto(out *Trust) {
 		*out = make([]Signer, len(*in))
 		copy(*out, *in)
 	}
+	if in.SignerGroups != nil {
+		in, out := &in.SignerGroups, &out.SignerGroups
+		*out = make([]SignerGroup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -260,6 +343,11 @@ func (in *VA) DeepCopyInto(out *VA) {
 			**out = **in
 		}
 	}
+	if in.Exemptions != nil {
+		in, out := &in.Exemptions, &out.Exemptions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -0,0 +1,285 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Keys of the certificates in the Secret
+const (
+	CACertKey     = "caCert.pem"
+	CAKeyKey      = "caKey.pem"
+	CABundleKey   = "caBundle.pem"
+	ServerCertKey = "serverCert.pem"
+	ServerKeyKey  = "serverKey.pem"
+)
+
+// Default lifetimes of the generated certificates
+const (
+	DefaultCAValidity      = 10 * 365 * 24 * time.Hour
+	DefaultServingValidity = 365 * 24 * time.Hour
+	// DefaultRenewBefore is how long before it expires the serving certificate is renewed
+	DefaultRenewBefore = 30 * 24 * time.Hour
+)
+
+// maxAttempts is the number of times a write is retried when it conflicts with another replica
+const maxAttempts = 5
+
+// Certificates are the webhook's serving certificate and the CA bundle the api server should trust
+type Certificates struct {
+	CABundle   []byte
+	ServerCert []byte
+	ServerKey  []byte
+}
+
+// Manager generates the webhook's CA and serving certificate, stores them in a Secret shared by all replicas,
+// renews them before they expire and keeps the caBundle of the MutatingWebhookConfiguration up to date
+type Manager struct {
+	kubeClient        kubernetes.Interface
+	namespace         string
+	serviceName       string
+	secretName        string
+	webhookConfigName string
+	caValidity        time.Duration
+	servingValidity   time.Duration
+	renewBefore       time.Duration
+	now               func() time.Time
+	// current is the certificates last returned by EnsureCertificates
+	current *Certificates
+}
+
+// NewManager creates a certificate manager for the webhook service in the namespace
+func NewManager(kubeClient kubernetes.Interface, namespace, serviceName, secretName, webhookConfigName string) *Manager {
+	return &Manager{
+		kubeClient:        kubeClient,
+		namespace:         namespace,
+		serviceName:       serviceName,
+		secretName:        secretName,
+		webhookConfigName: webhookConfigName,
+		caValidity:        DefaultCAValidity,
+		servingValidity:   DefaultServingValidity,
+		renewBefore:       DefaultRenewBefore,
+		now:               time.Now,
+	}
+}
+
+// dnsNames returns the names the api server may use to reach the webhook service
+func (m *Manager) dnsNames() []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", m.serviceName, m.namespace),
+		m.serviceName,
+		fmt.Sprintf("%s.%s", m.serviceName, m.namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", m.serviceName, m.namespace),
+	}
+}
+
+// EnsureCertificates reads the certificates from the Secret, generating them if they do not exist and renewing them if they are close to expiry
+// When several replicas write the Secret at once, the first write wins and the others use the certificates it stored
+func (m *Manager) EnsureCertificates() (*Certificates, error) {
+	secrets := m.kubeClient.CoreV1().Secrets(m.namespace)
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		exists := true
+		secret, err := secrets.Get(m.secretName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			exists = false
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: m.secretName, Namespace: m.namespace},
+				Type:       corev1.SecretTypeOpaque,
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, changed, err := m.renew(secret.Data)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			secret.Data = data
+			if exists {
+				_, err = secrets.Update(secret)
+			} else {
+				_, err = secrets.Create(secret)
+			}
+			if k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err) {
+				glog.Infof("Secret %s/%s was written by another replica, reading it again", m.namespace, m.secretName)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			glog.Infof("Stored webhook certificates in Secret %s/%s", m.namespace, m.secretName)
+		}
+
+		m.current = &Certificates{
+			CABundle:   data[CABundleKey],
+			ServerCert: data[ServerCertKey],
+			ServerKey:  data[ServerKeyKey],
+		}
+		return m.current, nil
+	}
+	return nil, fmt.Errorf("could not write Secret %s/%s after %d attempts", m.namespace, m.secretName, maxAttempts)
+}
+
+// renew returns the Secret data with any missing, invalid or expiring certificates replaced, and whether anything was replaced
+func (m *Manager) renew(data map[string][]byte) (map[string][]byte, bool, error) {
+	now := m.now()
+	renewed := map[string][]byte{}
+	for k, v := range data {
+		renewed[k] = v
+	}
+
+	// The CA is renewed once it would expire before a newly issued serving certificate
+	ca, err := parseKeyPair(data[CACertKey], data[CAKeyKey])
+	newCA := err != nil || now.Add(m.servingValidity).After(ca.cert.NotAfter)
+	if newCA {
+		ca, err = generateCA(m.serviceName+"_ca", now, m.caValidity)
+		if err != nil {
+			return nil, false, err
+		}
+		renewed[CACertKey], renewed[CAKeyKey] = ca.certPEM, ca.keyPEM
+		glog.Infof("Generated webhook CA, serial %s expires %v", ca.cert.SerialNumber, ca.cert.NotAfter)
+	}
+	// Keep trusting the previous CA until it expires, so replicas still serving a certificate it issued are not rejected
+	renewed[CABundleKey] = trustBundle(ca, append(append([]byte{}, data[CABundleKey]...), data[CACertKey]...), now)
+
+	server, err := parseKeyPair(data[ServerCertKey], data[ServerKeyKey])
+	if newCA || err != nil || now.Add(m.renewBefore).After(server.cert.NotAfter) || !m.valid(server, ca) {
+		server, err = generateServing(ca, m.dnsNames(), now, m.servingValidity)
+		if err != nil {
+			return nil, false, err
+		}
+		renewed[ServerCertKey], renewed[ServerKeyKey] = server.certPEM, server.keyPEM
+		glog.Infof("Generated webhook serving certificate, serial %s expires %v", server.cert.SerialNumber, server.cert.NotAfter)
+	}
+
+	changed := len(renewed) != len(data)
+	for k, v := range renewed {
+		if !bytes.Equal(v, data[k]) {
+			changed = true
+		}
+	}
+	return renewed, changed, nil
+}
+
+// valid returns true if the serving certificate was issued by the CA for the names of the service
+func (m *Manager) valid(server, ca *keyPair) bool {
+	if server.cert.CheckSignatureFrom(ca.cert) != nil {
+		return false
+	}
+	for _, name := range m.dnsNames() {
+		if server.cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// trustBundle returns the PEM encoded CA followed by the previous CAs that have not expired
+func trustBundle(ca *keyPair, previous []byte, now time.Time) []byte {
+	bundle := append([]byte{}, ca.certPEM...)
+	seen := map[string]bool{string(ca.cert.Raw): true}
+	for _, cert := range parseCertificates(previous) {
+		if seen[string(cert.Raw)] || !cert.IsCA || now.After(cert.NotAfter) {
+			continue
+		}
+		seen[string(cert.Raw)] = true
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return bundle
+}
+
+// PatchWebhookConfiguration sets the caBundle of every webhook in the MutatingWebhookConfiguration
+func (m *Manager) PatchWebhookConfiguration(caBundle []byte) error {
+	configs := m.kubeClient.AdmissionregistrationV1beta1().MutatingWebhookConfigurations()
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		config, err := configs.Get(m.webhookConfigName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		for i := range config.Webhooks {
+			if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				config.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		_, err = configs.Update(config)
+		if k8serrors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		glog.Infof("Updated caBundle of MutatingWebhookConfiguration %s", m.webhookConfigName)
+		return nil
+	}
+	return fmt.Errorf("could not update MutatingWebhookConfiguration %s after %d attempts", m.webhookConfigName, maxAttempts)
+}
+
+// Run ensures the certificates and the caBundle every interval until stopCh is closed.
+// onRotate is called with the new serving certificate and key when they change, e.g. to serve them without a restart.
+// The webhook configuration may not exist until after the webhook has started, so it is patched on every interval.
+func (m *Manager) Run(onRotate func(certPEM, keyPEM []byte) error, interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.sync(onRotate)
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync ensures the certificates, calls onRotate if the serving certificate changed and patches the caBundle
+func (m *Manager) sync(onRotate func(certPEM, keyPEM []byte) error) {
+	previous := m.current
+	certs, err := m.EnsureCertificates()
+	if err != nil {
+		glog.Errorf("Could not ensure webhook certificates: %v", err)
+		return
+	}
+	if previous == nil || !bytes.Equal(previous.ServerCert, certs.ServerCert) {
+		if err := onRotate(certs.ServerCert, certs.ServerKey); err != nil {
+			glog.Errorf("Could not serve the renewed webhook certificate: %v", err)
+			// Try again on the next interval
+			m.current = previous
+		}
+	}
+	if err := m.PatchWebhookConfiguration(certs.CABundle); err != nil {
+		if k8serrors.IsNotFound(err) {
+			glog.Infof("MutatingWebhookConfiguration %s does not exist yet", m.webhookConfigName)
+		} else {
+			glog.Errorf("Could not patch the caBundle of MutatingWebhookConfiguration %s: %v", m.webhookConfigName, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certs
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestManager(objects ...runtime.Object) (*Manager, *k8sfake.Clientset) {
+	kubeClientset := k8sfake.NewSimpleClientset(objects...)
+	return NewManager(kubeClientset, "ibm-system", "portieris", "portieris-certs", "image-admission-config"), kubeClientset
+}
+
+// verify checks the serving certificate is trusted by the bundle for the service's DNS name
+func verify(t *testing.T, certs *Certificates, at time.Time) {
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certs.CABundle))
+	server, err := parseKeyPair(certs.ServerCert, certs.ServerKey)
+	require.NoError(t, err)
+	_, err = server.cert.Verify(x509.VerifyOptions{DNSName: "portieris.ibm-system.svc", Roots: roots, CurrentTime: at})
+	assert.NoError(t, err)
+}
+
+func TestManager_EnsureCertificates(t *testing.T) {
+	m, kubeClientset := newTestManager()
+	certs, err := m.EnsureCertificates()
+	require.NoError(t, err)
+	verify(t, certs, time.Now())
+
+	secret, err := kubeClientset.CoreV1().Secrets("ibm-system").Get("portieris-certs", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, certs.ServerCert, secret.Data[ServerCertKey])
+	assert.Equal(t, certs.ServerKey, secret.Data[ServerKeyKey])
+	assert.Equal(t, certs.CABundle, secret.Data[CABundleKey])
+	assert.NotEmpty(t, secret.Data[CAKeyKey])
+
+	t.Run("rejects a key that does not match the certificate", func(t *testing.T) {
+		_, err := parseKeyPair(certs.ServerCert, secret.Data[CAKeyKey])
+		assert.Error(t, err)
+	})
+
+	t.Run("reuses the stored certificates", func(t *testing.T) {
+		again, err := NewManager(kubeClientset, "ibm-system", "portieris", "portieris-certs", "image-admission-config").EnsureCertificates()
+		require.NoError(t, err)
+		assert.Equal(t, certs, again)
+	})
+
+	t.Run("renews the serving certificate before it expires", func(t *testing.T) {
+		later := time.Now().Add(DefaultServingValidity - DefaultRenewBefore + time.Hour)
+		m.now = func() time.Time { return later }
+		renewed, err := m.EnsureCertificates()
+		require.NoError(t, err)
+		assert.NotEqual(t, certs.ServerCert, renewed.ServerCert)
+		assert.Equal(t, certs.CABundle, renewed.CABundle, "the CA should not be renewed")
+		verify(t, renewed, later)
+	})
+
+	t.Run("renews the CA and keeps trusting the previous CA", func(t *testing.T) {
+		later := time.Now().Add(DefaultCAValidity - DefaultServingValidity + time.Hour)
+		m.now = func() time.Time { return later }
+		renewed, err := m.EnsureCertificates()
+		require.NoError(t, err)
+		verify(t, renewed, later)
+		bundle := parseCertificates(renewed.CABundle)
+		require.Len(t, bundle, 2)
+		assert.Equal(t, parseCertificates(certs.CABundle)[0].Raw, bundle[1].Raw)
+	})
+}
+
+func TestManager_EnsureCertificates_ReplacesInvalidSecret(t *testing.T) {
+	// A Secret created from the static certificates has no CA key
+	m, _ := newTestManager(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "portieris-certs", Namespace: "ibm-system"},
+		Data: map[string][]byte{
+			ServerCertKey: []byte("not a certificate"),
+			ServerKeyKey:  []byte("not a key"),
+		},
+	})
+	certs, err := m.EnsureCertificates()
+	require.NoError(t, err)
+	verify(t, certs, time.Now())
+}
+
+func TestManager_EnsureCertificates_CreatedByAnotherReplica(t *testing.T) {
+	otherClientset := k8sfake.NewSimpleClientset()
+	other, err := NewManager(otherClientset, "ibm-system", "portieris", "portieris-certs", "image-admission-config").EnsureCertificates()
+	require.NoError(t, err)
+	otherSecret, err := otherClientset.CoreV1().Secrets("ibm-system").Get("portieris-certs", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// Another replica creates the Secret between this replica reading and creating it
+	m, kubeClientset := newTestManager(otherSecret)
+	gets := 0
+	kubeClientset.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 1 {
+			return true, nil, k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "portieris-certs")
+		}
+		return false, nil, nil
+	})
+
+	certs, err := m.EnsureCertificates()
+	require.NoError(t, err)
+	assert.Equal(t, other, certs)
+}
+
+func TestManager_PatchWebhookConfiguration(t *testing.T) {
+	m, kubeClientset := newTestManager(&admissionregistrationv1beta1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-admission-config"},
+		Webhooks: []admissionregistrationv1beta1.Webhook{
+			{Name: "trust.hooks.securityenforcement.admission.cloud.ibm.com"},
+			{Name: "other.hooks.securityenforcement.admission.cloud.ibm.com", ClientConfig: admissionregistrationv1beta1.WebhookClientConfig{CABundle: []byte("old")}},
+		},
+	})
+	require.NoError(t, m.PatchWebhookConfiguration([]byte("bundle")))
+
+	config, err := kubeClientset.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get("image-admission-config", metav1.GetOptions{})
+	require.NoError(t, err)
+	for _, webhook := range config.Webhooks {
+		assert.Equal(t, []byte("bundle"), webhook.ClientConfig.CABundle)
+	}
+
+	t.Run("error if the configuration does not exist", func(t *testing.T) {
+		m, _ := newTestManager()
+		err := m.PatchWebhookConfiguration([]byte("bundle"))
+		assert.True(t, k8serrors.IsNotFound(err))
+	})
+}
+
+func TestManager_Sync(t *testing.T) {
+	m, _ := newTestManager()
+	rotations := 0
+	onRotate := func(certPEM, keyPEM []byte) error {
+		rotations++
+		return nil
+	}
+
+	m.sync(onRotate)
+	assert.Equal(t, 1, rotations, "the first certificate should be served")
+	m.sync(onRotate)
+	assert.Equal(t, 1, rotations, "an unchanged certificate should not be served again")
+
+	later := time.Now().Add(DefaultServingValidity)
+	m.now = func() time.Time { return later }
+	m.sync(onRotate)
+	assert.Equal(t, 2, rotations, "the renewed certificate should be served")
+}
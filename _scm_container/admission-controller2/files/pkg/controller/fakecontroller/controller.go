@@ -14,13 +14,13 @@
 
 package fakecontroller
 
-import admissionv1beta1 "k8s.io/api/admission/v1beta1"
+import "admission-controller2/types"
 
 // Controller is a fake controller for stubbing
 type Controller struct {
 }
 
 // Admit is a fake admit function for stubbing
-func (c *Controller) Admit(admissionRequest *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
-	return &admissionv1beta1.AdmissionResponse{Allowed: true}
+func (c *Controller) Admit(admissionRequest *types.AdmissionRequest) *types.AdmissionResponse {
+	return &types.AdmissionResponse{Allowed: true}
 }
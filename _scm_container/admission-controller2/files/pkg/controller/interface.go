@@ -14,9 +14,10 @@
 
 package controller
 
-import admissionv1beta1 "k8s.io/api/admission/v1beta1"
+import "admission-controller2/types"
 
 // Interface are the methods required to implement a controller for the webhook package
+// The request and response are version independent, the webhook handles the AdmissionReview version
 type Interface interface {
-	Admit(*admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
+	Admit(*types.AdmissionRequest) *types.AdmissionResponse
 }
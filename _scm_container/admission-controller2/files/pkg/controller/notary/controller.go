@@ -19,21 +19,25 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"admission-controller2/helpers/image"
 	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
 	"admission-controller2/pkg/kubernetes"
+	"admission-controller2/pkg/metrics"
 	"admission-controller2/pkg/notary"
 	"admission-controller2/pkg/policy"
 	registryclient "admission-controller2/pkg/registry"
+	"admission-controller2/pkg/va"
 	"admission-controller2/pkg/webhook"
 	"admission-controller2/types"
 	"github.com/golang/glog"
 	store "github.com/theupdateframework/notary/storage"
-	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/tools/record"
 )
 
 var codec = serializer.NewCodecFactory(runtime.NewScheme())
@@ -48,20 +52,42 @@ type Controller struct {
 	trust notary.Interface
 	// Container Registry client
 	cr registryclient.Interface
+	// Vulnerability scanner, nil if no scanner is configured
+	scanner va.Interface
+	// Cache of verified signed digests, nil if digests are not cached
+	digestCache *DigestCache
+	// recordEvents is true if denials and mutations are recorded as events on the namespace
+	recordEvents bool
+	// eventRecorder records the events, it is created when recording events is turned on
+	eventRecorder record.EventRecorder
 }
 
 // NewController creates a new controller object from the various clients passed in
-func NewController(kubeWrapper kubernetes.WrapperInterface, policyClient policy.Interface, trust notary.Interface, cr registryclient.Interface) *Controller {
+func NewController(kubeWrapper kubernetes.WrapperInterface, policyClient policy.Interface, trust notary.Interface, cr registryclient.Interface, scanner va.Interface) *Controller {
 	return &Controller{
 		kubeClientsetWrapper: kubeWrapper,
 		policyClient:         policyClient,
 		trust:                trust,
 		cr:                   cr,
+		scanner:              scanner,
+	}
+}
+
+// SetDigestCache sets the cache used to avoid fetching trust data for digests that were recently verified
+func (c *Controller) SetDigestCache(digestCache *DigestCache) {
+	c.digestCache = digestCache
+}
+
+// SetRecordEvents sets whether denials and mutations are recorded as events on the namespace of the request
+func (c *Controller) SetRecordEvents(recordEvents bool) {
+	c.recordEvents = recordEvents
+	if recordEvents && c.eventRecorder == nil {
+		c.eventRecorder = newEventRecorder(c.kubeClientsetWrapper)
 	}
 }
 
 // Admit is the admissionRequest handler
-func (c *Controller) Admit(admissionRequest *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+func (c *Controller) Admit(admissionRequest *types.AdmissionRequest) *types.AdmissionResponse {
 	glog.Infof("Processing Trust Admission Request for %s on %s", admissionRequest.Operation, admissionRequest.Name)
 
 	podSpecLocation, ps, err := c.kubeClientsetWrapper.GetPodSpec(admissionRequest)
@@ -69,7 +95,7 @@ func (c *Controller) Admit(admissionRequest *admissionv1beta1.AdmissionRequest)
 	case nil:
 		break
 	case kubernetes.ErrObjectHasParents, kubernetes.ErrObjectHasZeroReplicas:
-		return &admissionv1beta1.AdmissionResponse{
+		return &types.AdmissionResponse{
 			Allowed: true,
 		}
 	default:
@@ -77,12 +103,73 @@ func (c *Controller) Admit(admissionRequest *admissionv1beta1.AdmissionRequest)
 		a.ToAdmissionResponse(err)
 		return a.Flush()
 	}
-	return c.mutatePodSpec(admissionRequest.Namespace, podSpecLocation, *ps)
+	return c.mutatePodSpec(admissionRequest, podSpecLocation, *ps)
+}
+
+// getObjectMeta returns the metadata of the object being admitted, e.g. the labels of a Deployment rather than of its pod template
+func getObjectMeta(request *types.AdmissionRequest) metav1.ObjectMeta {
+	object := struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+	}{}
+	if err := json.Unmarshal(request.Object.Raw, &object); err != nil {
+		glog.Warningf("Unable to get the metadata of %s %s/%s: %v", request.Kind.Kind, request.Namespace, request.Name, err)
+	}
+	return object.ObjectMeta
 }
-func (c *Controller) mutatePodSpec(namespace, specPath string, pod corev1.PodSpec) *admissionv1beta1.AdmissionResponse {
+
+func (c *Controller) mutatePodSpec(request *types.AdmissionRequest, specPath string, pod corev1.PodSpec) *types.AdmissionResponse {
+	namespace, kind := request.Namespace, request.Kind.Kind
+	objectLabels := getObjectMeta(request).Labels
 	a := &webhook.AdmissionResponder{}
 	patches := []types.JSONPatch{}
 
+	// match is the policy of the image being checked and where it came from, policy is the matched policy, both are nil until it is found
+	var match *securityenforcementv1beta1.PolicyMatch
+	var policy *securityenforcementv1beta1.Policy
+	// unenforced counts the denials that were not enforced
+	unenforced := 0
+	// annotationPrefix identifies the container being checked in audit annotations, e.g. containers.0
+	annotationPrefix := "pod"
+
+	// annotate adds an audit annotation about the container being checked
+	annotate := func(key, value string) {
+		a.AddAuditAnnotation(fmt.Sprintf("%s.%s", annotationPrefix, key), value)
+	}
+
+	// deny adds the message to the response and counts the denial by reason
+	// If the policy is in warn or audit mode the image is allowed, and the denial is logged, counted and recorded as an event instead
+	deny := func(reason, msg string) {
+		if match != nil {
+			msg = fmt.Sprintf("%s, matched %s", msg, match)
+		}
+		mode := securityenforcementv1beta1.EnforcementModeEnforce
+		if policy != nil {
+			mode = policy.GetEnforcementMode()
+		}
+		if mode == securityenforcementv1beta1.EnforcementModeEnforce {
+			metrics.Denials.WithLabelValues(namespace, kind, reason).Inc()
+			a.StringToAdmissionResponse(msg)
+			annotate("denied", msg)
+			if c.recordEvents {
+				c.recordEvent(request, corev1.EventTypeWarning, EventReasonImageDenied, msg)
+			}
+			return
+		}
+		msg = fmt.Sprintf("%s (not enforced, policy is in %s mode)", msg, mode)
+		glog.Warningf("Allowing %s %s/%s: %s", kind, namespace, request.Name, msg)
+		metrics.UnenforcedDenials.WithLabelValues(namespace, kind, reason, mode).Inc()
+		if c.recordEvents {
+			c.recordEvent(request, corev1.EventTypeWarning, EventReasonUnenforcedDenial, msg)
+		}
+		// Audit mode findings are only kept in the audit log, warn mode findings are also shown to the user
+		unenforced++
+		a.AddAuditAnnotation(fmt.Sprintf("unenforced-denial-%d", unenforced), msg)
+		if mode == securityenforcementv1beta1.EnforcementModeWarn {
+			a.AddWarning(msg)
+		}
+		a.SetAllowed()
+	}
+
 	// Iterate over each container image specified
 	for _, containerType := range []string{"initContainers", "containers"} {
 		var containers []corev1.Container
@@ -92,25 +179,74 @@ func (c *Controller) mutatePodSpec(namespace, specPath string, pod corev1.PodSpe
 		case "containers":
 			containers = pod.Containers
 		default:
-			a.StringToAdmissionResponse("Unhandled container type")
+			deny(metrics.ReasonInternal, "Unhandled container type")
 			return a.Flush()
 		}
 
 	containerLoop:
 		for containerIndex, container := range containers {
-			var policy *securityenforcementv1beta1.Policy
+			match, policy = nil, nil
+			annotationPrefix = fmt.Sprintf("%s.%d", containerType, containerIndex)
 			img, err := image.NewReference(container.Image)
 			if err != nil {
 				glog.Error(err)
-				a.StringToAdmissionResponse(fmt.Sprintf("Deny %q, invalid image name", container.Image))
+				deny(metrics.ReasonInvalidImage, fmt.Sprintf("Deny %q, invalid image name", container.Image))
 				continue containerLoop
 			}
 
 			glog.Infof("Container Image: %s   Namespace: %s", img.String(), namespace)
-			if policy, err = c.policyClient.GetPolicyToEnforce(namespace, img.String()); err != nil {
-				a.StringToAdmissionResponse(err.Error())
+			start := time.Now()
+			match, err = c.policyClient.GetPolicyToEnforce(namespace, img.String(), objectLabels)
+			metrics.ObserveDependency(metrics.DependencyPolicy, start, err)
+			if err != nil {
+				deny(metrics.ReasonPolicy, err.Error())
+				continue containerLoop
+			}
+			if match != nil {
+				policy = &match.Policy
+				glog.Infof("Image %s matched %s", img.String(), match)
+				annotate("policy", match.String())
+				if match.Deny {
+					msg := fmt.Sprintf("Deny %q, the repository is denied", img.String())
+					if match.Message != "" {
+						msg = fmt.Sprintf("%s: %s", msg, match.Message)
+					}
+					deny(metrics.ReasonDeniedRepository, msg)
+					continue containerLoop
+				}
+			}
+			if reason, denial := checkTags(img, policy); denial != "" {
+				deny(reason, denial)
 				continue containerLoop
-			} else if policy == nil || !(policy.Trust.Enabled != nil && *policy.Trust.Enabled == true) {
+			}
+			if match != nil && match.Floor != nil {
+				// Tag constraints are not merged into the policy, the image must also meet those of the floor
+				if reason, denial := checkTags(img, &match.Floor.Policy); denial != "" {
+					deny(reason, denial)
+					continue containerLoop
+				}
+			}
+			if policy == nil || !(policy.Trust.Enabled != nil && *policy.Trust.Enabled == true) {
+				// Without trust the digest is only known if the image was specified by digest, otherwise VA resolves the tag
+				resolved, denial := c.checkVulnerabilities(namespace, img, img.GetDigest(), pod.ImagePullSecrets, policy)
+				if denial != "" {
+					deny(metrics.ReasonVulnerabilities, denial)
+					continue containerLoop
+				}
+				if resolved != "" {
+					// Pin the image to the digest that was checked, the tag could be moved to an image that was not
+					glog.Infof("Mutated to: %s@sha256:%s", img.String(), resolved)
+					patches = append(patches, types.JSONPatch{
+						Op:    "replace",
+						Path:  fmt.Sprintf("%s/%s/%s/image", specPath, containerType, strconv.Itoa(containerIndex)),
+						Value: fmt.Sprintf("%s@sha256:%s", img.NameWithTag(), resolved),
+					})
+					annotate("digest", "sha256:"+resolved)
+					a.AddWarning(fmt.Sprintf("image %q was pinned to digest sha256:%s checked for vulnerabilities", img.String(), resolved))
+					if c.recordEvents {
+						c.recordEvent(request, corev1.EventTypeNormal, EventReasonImageMutated, fmt.Sprintf("Pinned image %q to digest sha256:%s checked for vulnerabilities", img.String(), resolved))
+					}
+				}
 				a.SetAllowed()
 				continue containerLoop
 			}
@@ -121,17 +257,19 @@ func (c *Controller) mutatePodSpec(namespace, specPath string, pod corev1.PodSpe
 			// Make sure image sure there is a ImagePullSecret defined
 			// TODO: This prevents use of signed publically available images with publically available signing data
 			if len(pod.ImagePullSecrets) == 0 {
-				a.StringToAdmissionResponse(fmt.Sprintf("Deny %q, no ImagePullSecret defined for %s", img.String(), img.GetHostname()))
+				deny(metrics.ReasonNoPullSecret, fmt.Sprintf("Deny %q, no ImagePullSecret defined for %s", img.String(), img.GetHostname()))
 				continue containerLoop
 			}
 
+			// verified is set once a pull secret of this container gave access to a signed digest, the response may already be allowed by other containers
+			verified := false
 		secretLoop:
 			for _, secret := range pod.ImagePullSecrets {
 				notaryURL := policy.Trust.TrustServer
 				if notaryURL == "" {
 					notaryURL, err = img.GetContentTrustURL()
 					if err != nil {
-						a.StringToAdmissionResponse(fmt.Sprintf("Trust Server/Image Configuration Error: %v", err.Error()))
+						deny(metrics.ReasonTrustConfiguration, fmt.Sprintf("Trust Server/Image Configuration Error: %v", err.Error()))
 						continue containerLoop
 					}
 				}
@@ -142,7 +280,9 @@ func (c *Controller) mutatePodSpec(namespace, specPath string, pod corev1.PodSpe
 					continue secretLoop
 				}
 
-				notaryToken, err := c.cr.GetContentTrustToken(username, password, img.NameWithoutTag(), img.GetRegistryURL())
+				start := time.Now()
+				notaryToken, err := c.cr.GetContentTrustToken(username, password, img.NameWithoutTag(), img.GetRegistryURL(), notaryURL)
+				metrics.ObserveDependency(metrics.DependencyToken, start, err)
 				if err != nil {
 					glog.Error(err)
 					continue secretLoop
@@ -152,31 +292,71 @@ func (c *Controller) mutatePodSpec(namespace, specPath string, pod corev1.PodSpe
 				if policy.Trust.SignerSecrets != nil {
 					// Generate a []Singer with the values for each signerSecret
 					signers = make([]Signer, len(policy.Trust.SignerSecrets))
-					for i, secretName := range policy.Trust.SignerSecrets {
-						signers[i], err = c.getSignerSecret(namespace, secretName.Name)
+					for i, ref := range policy.Trust.SignerSecrets {
+						signers[i], err = c.getSigner(namespace, match, ref)
 						if err != nil {
-							a.StringToAdmissionResponse(fmt.Sprintf("Deny %q, could not get signerSecret from your cluster, %s", img.String(), err.Error()))
+							deny(metrics.ReasonSignerSecret, fmt.Sprintf("Deny %q, could not get signerSecret from your cluster, %s", img.String(), err.Error()))
 							continue containerLoop
 						}
 					}
 				}
+				groups, err := c.getSignerGroups(namespace, match, policy.Trust.SignerGroups)
+				if err != nil {
+					deny(metrics.ReasonSignerSecret, fmt.Sprintf("Deny %q, could not get signerGroups from your cluster, %s", img.String(), err.Error()))
+					continue containerLoop
+				}
 
 				// Get image digest
 				glog.Info("getting signed image...")
 
-				digest, err := c.getDigest(notaryURL, img.NameWithoutTag(), notaryToken, img.GetTag(), signers)
-				if err != nil {
-					if strings.Contains(err.Error(), "401") {
-						continue secretLoop
+				digestKey := newDigestCacheKey(notaryURL, img.NameWithoutTag(), img.GetTag(), signers, groups, username, password)
+				digest, groupSigners, cached := c.digestCache.get(digestKey)
+				if !cached {
+					start = time.Now()
+					digest, groupSigners, err = c.getDigest(notaryURL, img.NameWithoutTag(), notaryToken, img.GetTag(), signers, groups)
+					metrics.ObserveDependency(metrics.DependencyNotary, start, err)
+					if err != nil && strings.Contains(err.Error(), "401") {
+						// The token may have been cached after it was revoked, discard it and retry once with a new token
+						c.cr.InvalidateContentTrustToken(username, password, img.NameWithoutTag(), img.GetRegistryURL(), notaryURL)
+						start = time.Now()
+						notaryToken, err = c.cr.GetContentTrustToken(username, password, img.NameWithoutTag(), img.GetRegistryURL(), notaryURL)
+						metrics.ObserveDependency(metrics.DependencyToken, start, err)
+						if err != nil {
+							glog.Error(err)
+							continue secretLoop
+						}
+						start = time.Now()
+						digest, groupSigners, err = c.getDigest(notaryURL, img.NameWithoutTag(), notaryToken, img.GetTag(), signers, groups)
+						metrics.ObserveDependency(metrics.DependencyNotary, start, err)
 					}
-					a.StringToAdmissionResponse(fmt.Sprintf("Deny %q, failed to get content trust information: %s", img.String(), err.Error()))
-					if _, ok := err.(store.ErrServerUnavailable); ok {
-						glog.Errorf("Trust server unavailable: %v", err)
-						return a.Flush()
+					if err != nil {
+						if strings.Contains(err.Error(), "401") {
+							c.cr.InvalidateContentTrustToken(username, password, img.NameWithoutTag(), img.GetRegistryURL(), notaryURL)
+							continue secretLoop
+						}
+						if _, ok := err.(store.ErrServerUnavailable); ok {
+							deny(metrics.ReasonTrustServerUnavailable, fmt.Sprintf("Deny %q, failed to get content trust information: %s", img.String(), err.Error()))
+							glog.Errorf("Trust server unavailable: %v", err)
+							if a.HasErrors() {
+								return a.Flush()
+							}
+							continue containerLoop
+						}
+						deny(metrics.ReasonTrustData, fmt.Sprintf("Deny %q, failed to get content trust information: %s", img.String(), err.Error()))
+						glog.Warningf("Failed to get trust information for %q: %v", img.String(), err)
+						continue containerLoop
 					}
-					glog.Warningf("Failed to get trust information for %q: %v", img.String(), err)
+					c.digestCache.add(digestKey, digest, groupSigners)
+				}
+				if _, denial := c.checkVulnerabilities(namespace, img, digest.String(), pod.ImagePullSecrets, policy); denial != "" {
+					deny(metrics.ReasonVulnerabilities, denial)
 					continue containerLoop
 				}
+				annotate("digest", "sha256:"+digest.String())
+				if len(signers) > 0 || len(groupSigners) > 0 {
+					annotate("signers", signerRoles(signers, groupSigners))
+				}
+
 				glog.Infof("Mutation #: %s %d  Image name: %s", containerType, containerIndex+1, img.String())
 				if strings.Contains(container.Image, img.String()) {
 					glog.Infof("Mutated to: %s@sha256:%s", img.String(), digest.String())
@@ -185,12 +365,17 @@ func (c *Controller) mutatePodSpec(namespace, specPath string, pod corev1.PodSpe
 						Path:  fmt.Sprintf("%s/%s/%s/image", specPath, containerType, strconv.Itoa(containerIndex)),
 						Value: fmt.Sprintf("%s@sha256:%s", img.NameWithTag(), digest.String()),
 					})
+					a.AddWarning(fmt.Sprintf("image %q was pinned to signed digest sha256:%s", img.String(), digest.String()))
+					if c.recordEvents {
+						c.recordEvent(request, corev1.EventTypeNormal, EventReasonImageMutated, fmt.Sprintf("Pinned image %q to signed digest sha256:%s", img.String(), digest.String()))
+					}
 				}
+				verified = true
 				a.SetAllowed()
 				break secretLoop
 			}
-			if !a.IsAllowed() {
-				a.StringToAdmissionResponse(fmt.Sprintf("Deny %q, no valid ImagePullSecret defined for %s", img.String(), img.GetHostname()))
+			if !verified {
+				deny(metrics.ReasonNoValidPullSecret, fmt.Sprintf("Deny %q, no valid ImagePullSecret defined for %s", img.String(), img.GetHostname()))
 			}
 		}
 	}
@@ -203,7 +388,7 @@ func (c *Controller) mutatePodSpec(namespace, specPath string, pod corev1.PodSpe
 	if len(patches) > 0 {
 		jsonPatch, err := json.Marshal(patches)
 		if err != nil {
-			a.StringToAdmissionResponse(fmt.Sprintf("Invalid Patch: %s", err.Error()))
+			deny(metrics.ReasonInternal, fmt.Sprintf("Invalid Patch: %s", err.Error()))
 			return a.Flush()
 		}
 		glog.Infof("Mutation patch: %s", string(jsonPatch))
@@ -0,0 +1,131 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"admission-controller2/pkg/metrics"
+	"github.com/golang/glog"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// digestCacheKey identifies a verified digest by where it was fetched from, the signers it was verified against
+// and the credential used to fetch it, so that a cached digest is never returned to a pull secret that could not read it
+type digestCacheKey struct {
+	server     string
+	gun        string
+	tag        string
+	signers    string
+	groups     string
+	credential string
+}
+
+// newDigestCacheKey creates a digestCacheKey, only hashes of the credential and signer keys are kept
+func newDigestCacheKey(server, gun, tag string, signers []Signer, groups []signerGroup, username, password string) digestCacheKey {
+	groupIDs := make([]string, len(groups))
+	for i, group := range groups {
+		groupIDs[i] = fmt.Sprintf("%d:%s", group.threshold, signerIDs(group.signers))
+	}
+	return digestCacheKey{
+		server:     server,
+		gun:        gun,
+		tag:        tag,
+		signers:    signerIDs(signers),
+		groups:     strings.Join(groupIDs, ";"),
+		credential: hash(username + ":" + password),
+	}
+}
+
+// signerIDs returns the sorted names and key hashes of the signers
+func signerIDs(signers []Signer) string {
+	ids := make([]string, len(signers))
+	for i, signer := range signers {
+		ids[i] = signer.signer + "=" + hash(signer.publicKey)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+type cachedDigest struct {
+	digest string
+	// groupSigners are the delegation roles of the members of signer groups that signed the digest
+	groupSigners []string
+	added        time.Time
+}
+
+// DigestCache is a bounded cache of signed digests that have been verified against the trust server
+// Digests are kept for at most maxAge, so a tag that is re-signed is picked up within maxAge
+type DigestCache struct {
+	cache  *lru.Cache
+	maxAge time.Duration
+	// now returns the current time, it is replaced in tests
+	now func() time.Time
+}
+
+// NewDigestCache creates a DigestCache holding up to size digests for up to maxAge
+func NewDigestCache(size int, maxAge time.Duration) (*DigestCache, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &DigestCache{cache: cache, maxAge: maxAge, now: time.Now}, nil
+}
+
+// get returns the cached digest, and the group signers that signed it, for the key if it is not older than maxAge
+func (d *DigestCache) get(key digestCacheKey) (*bytes.Buffer, []string, bool) {
+	if d == nil {
+		return nil, nil, false
+	}
+	if value, ok := d.cache.Get(key); ok {
+		cached := value.(cachedDigest)
+		if d.now().Sub(cached.added) < d.maxAge {
+			metrics.DigestCacheLookups.WithLabelValues("hit").Inc()
+			return bytes.NewBufferString(cached.digest), cached.groupSigners, true
+		}
+		d.cache.Remove(key)
+	}
+	metrics.DigestCacheLookups.WithLabelValues("miss").Inc()
+	return nil, nil, false
+}
+
+// add caches a verified digest and the group signers that signed it
+func (d *DigestCache) add(key digestCacheKey, digest *bytes.Buffer, groupSigners []string) {
+	if d == nil {
+		return
+	}
+	d.cache.Add(key, cachedDigest{digest: digest.String(), groupSigners: groupSigners, added: d.now()})
+}
+
+// Purge removes all cached digests
+func (d *DigestCache) Purge() {
+	if d == nil {
+		return
+	}
+	d.cache.Purge()
+	metrics.DigestCachePurges.Inc()
+	glog.Info("Purged signed digest cache")
+}
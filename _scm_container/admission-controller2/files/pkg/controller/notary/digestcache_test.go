@@ -0,0 +1,92 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DigestCache", func() {
+
+	var (
+		cache *DigestCache
+		now   time.Time
+		key   digestCacheKey
+	)
+
+	BeforeEach(func() {
+		var err error
+		cache, err = NewDigestCache(2, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		now = time.Now()
+		cache.now = func() time.Time { return now }
+		key = newDigestCacheKey("https://notary.test.com", "test.com/hello", "latest", nil, nil, "user", "secret")
+	})
+
+	It("should return a cached digest", func() {
+		cache.add(key, bytes.NewBufferString("abcd"), []string{"targets/alice"})
+		digest, groupSigners, ok := cache.get(key)
+		Expect(ok).To(BeTrue())
+		Expect(digest.String()).To(Equal("abcd"))
+		Expect(groupSigners).To(Equal([]string{"targets/alice"}))
+	})
+
+	It("should not return a digest older than the max age", func() {
+		cache.add(key, bytes.NewBufferString("abcd"), nil)
+		now = now.Add(time.Minute)
+		_, _, ok := cache.get(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should evict the least recently used digest when full", func() {
+		other := newDigestCacheKey("https://notary.test.com", "test.com/hello", "v1", nil, nil, "user", "secret")
+		third := newDigestCacheKey("https://notary.test.com", "test.com/hello", "v2", nil, nil, "user", "secret")
+		cache.add(key, bytes.NewBufferString("abcd"), nil)
+		cache.add(other, bytes.NewBufferString("efgh"), nil)
+		cache.get(key)
+		cache.add(third, bytes.NewBufferString("ijkl"), nil)
+		_, _, ok := cache.get(other)
+		Expect(ok).To(BeFalse())
+		_, _, ok = cache.get(key)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should not return digests after a purge", func() {
+		cache.add(key, bytes.NewBufferString("abcd"), nil)
+		cache.Purge()
+		_, _, ok := cache.get(key)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should key digests by credential and signers", func() {
+		signers := []Signer{{signer: "wibble", publicKey: "key"}}
+		Expect(newDigestCacheKey("https://notary.test.com", "test.com/hello", "latest", nil, nil, "user", "other")).ToNot(Equal(key))
+		Expect(newDigestCacheKey("https://notary.test.com", "test.com/hello", "latest", signers, nil, "user", "secret")).ToNot(Equal(key))
+		Expect(newDigestCacheKey("https://notary.test.com", "test.com/hello", "latest", nil, []signerGroup{{signers: signers, threshold: 1}}, "user", "secret")).ToNot(Equal(key))
+		Expect(newDigestCacheKey("https://notary.test.com", "test.com/hello", "latest", nil, nil, "user", "secret")).To(Equal(key))
+	})
+
+	It("should be disabled when nil", func() {
+		var disabled *DigestCache
+		disabled.add(key, bytes.NewBufferString("abcd"), nil)
+		_, _, ok := disabled.get(key)
+		Expect(ok).To(BeFalse())
+		disabled.Purge()
+	})
+})
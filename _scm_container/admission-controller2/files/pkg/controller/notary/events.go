@@ -0,0 +1,80 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"admission-controller2/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// eventSource is the component recorded as the source of events
+	eventSource = "portieris"
+	// EventReasonUnenforcedDenial is the reason of events recorded when a policy in warn or audit mode would have denied an image
+	EventReasonUnenforcedDenial = "UnenforcedPolicyDenial"
+	// EventReasonImageDenied is the reason of events recorded when an image is denied
+	EventReasonImageDenied = "ImageDenied"
+	// EventReasonImageMutated is the reason of events recorded when an image is pinned to its signed digest
+	EventReasonImageMutated = "ImageMutated"
+)
+
+// newEventRecorder creates a recorder that sends events to the api server through a broadcaster
+// The broadcaster creates events in the background, rate limiting them and aggregating repeated ones
+func newEventRecorder(kubeClientset kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(eventSink{kubeClientset: kubeClientset})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventSource})
+}
+
+// eventSink writes each event to the namespace of the event
+type eventSink struct {
+	kubeClientset kubernetes.Interface
+}
+
+func (s eventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	return s.kubeClientset.CoreV1().Events(event.Namespace).CreateWithEventNamespace(event)
+}
+
+func (s eventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	return s.kubeClientset.CoreV1().Events(event.Namespace).UpdateWithEventNamespace(event)
+}
+
+func (s eventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	return s.kubeClientset.CoreV1().Events(event.Namespace).PatchWithEventNamespace(event, data)
+}
+
+// recordEvent records an event of the eventType against the object being admitted
+// The object may not exist yet, so the event references it by kind and name
+func (c *Controller) recordEvent(request *types.AdmissionRequest, eventType, reason, message string) {
+	name := request.Name
+	if name == "" {
+		name = getObjectMeta(request).Name
+	}
+	ref := &corev1.ObjectReference{
+		APIVersion: schema.GroupVersion{Group: request.Kind.Group, Version: request.Kind.Version}.String(),
+		Kind:       request.Kind.Kind,
+		Namespace:  request.Namespace,
+		Name:       name,
+	}
+	if name == "" {
+		// Objects created with generateName have no name yet, which the event name is made from, so the event is recorded on their namespace
+		ref = &corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Namespace: request.Namespace, Name: request.Namespace}
+	}
+	c.eventRecorder.Event(ref, eventType, reason, message)
+}
@@ -16,6 +16,7 @@ package notary
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -26,7 +27,9 @@ import (
 	"admission-controller2/pkg/notary/fakenotary"
 	"admission-controller2/pkg/policy"
 	"admission-controller2/pkg/registry/fakeregistry"
+	"admission-controller2/pkg/va/fakeva"
 	"admission-controller2/pkg/webhook"
+	"admission-controller2/types"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
@@ -63,6 +66,7 @@ var (
 	clusterimageObjects []runtime.Object
 	trust               *fakenotary.FakeNotary
 	cr                  *fakeregistry.FakeRegistry
+	scanner             *fakeva.FakeScanner
 	wh                  *webhook.Server
 )
 
@@ -73,10 +77,11 @@ func resetAllFakes() {
 	kubeWrapper = kubernetes.NewKubeClientsetWrapper(kubeClientset)
 	imageObjects = []runtime.Object{}
 	secClientset = securityenforcementfake.NewSimpleClientset(imageObjects...)
-	policyClient = policy.NewClient(secClientset)
+	policyClient = policy.NewClient(secClientset, kubeClientset)
 	trust = &fakenotary.FakeNotary{}
 	cr = &fakeregistry.FakeRegistry{}
-	ctrl = NewController(kubeWrapper, policyClient, trust, cr)
+	scanner = &fakeva.FakeScanner{}
+	ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
 	wh = webhook.NewServer("notary", ctrl, []byte{}, []byte{})
 }
 
@@ -191,6 +196,14 @@ func newFakeSecret(secretName, namespace, registry string) *corev1.Secret {
 	}
 }
 
+// newFakeAdmissionRequest creates the admission request sent by newFakeRequest, to call the controller directly
+func newFakeAdmissionRequest(image string) *types.AdmissionRequest {
+	review := types.AdmissionReview{}
+	err := json.NewDecoder(newFakeRequest(image).Body).Decode(&review)
+	Expect(err).ToNot(HaveOccurred())
+	return review.Request
+}
+
 // newFakeRequest creates a new http request
 func newFakeRequest(image string) *http.Request {
 	// TODO: Delete what we don't need for unit tests
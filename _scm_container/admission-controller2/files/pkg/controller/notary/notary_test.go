@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http/httptest"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 
@@ -26,6 +27,7 @@ import (
 	"admission-controller2/pkg/kubernetes"
 	"admission-controller2/pkg/notary/fakenotary"
 	"admission-controller2/pkg/policy"
+	"admission-controller2/pkg/va"
 	"admission-controller2/pkg/webhook"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -146,16 +148,18 @@ var _ = Describe("Main", func() {
 				policies = append(policies, clusterImagePolicy)
 			}
 			secClientset = securityenforcementfake.NewSimpleClientset(policies...)
-			policyClient = policy.NewClient(secClientset)
+			policyClient = policy.NewClient(secClientset, kubeClientset)
 
 			// Fake content trust token
 			cr.GetContentTrustTokenReturns("token", nil)
+			// Fake digest of the tag in the registry
+			cr.GetDigestReturns("sha256:6162636465666768696a", nil)
 
 			fakeGetRepo()
 		}
 
 		updateController := func() {
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
 			wh = webhook.NewServer("notary", ctrl, []byte{}, []byte{})
 		}
 
@@ -375,6 +379,36 @@ var _ = Describe("Main", func() {
 					Expect(resp.Response.Patch).To(BeEmpty())
 					Expect(resp.Response.Result.Message).To(ContainSubstring("FAKE_NO_SIGNED_IMAGE_ERROR"))
 				})
+
+				It("should record the denial in an audit annotation and an event if events are enabled", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					trust = &fakenotary.FakeNotary{}
+					trust.GetNotaryRepoReturns(nil, fmt.Errorf("FAKE_NO_SIGNED_IMAGE_ERROR"))
+					updateController()
+					ctrl.SetRecordEvents(true)
+					response := ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Expect(response.Allowed).To(BeFalse())
+					Expect(response.AuditAnnotations).To(HaveKeyWithValue("containers.0.denied", ContainSubstring("FAKE_NO_SIGNED_IMAGE_ERROR")))
+					Expect(response.Result.Message).To(ContainSubstring(`matched ImagePolicy default/namespace-policy repository "registry.ng.bluemix.net/*"`))
+					Eventually(func() int {
+						events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+						return len(events.Items)
+					}).Should(Equal(1))
+					events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+					Expect(events.Items[0].Reason).To(Equal(EventReasonImageDenied))
+					Expect(events.Items[0].Type).To(Equal(corev1.EventTypeWarning))
+				})
 			})
 
 			Context("if `trust is enabled` but the first secret is not valid", func() {
@@ -407,6 +441,74 @@ var _ = Describe("Main", func() {
 				})
 			})
 
+			Context("if `trust is enabled` and the signed digest is cached", func() {
+				It("should not fetch trust data again for the same image", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					updateController()
+					digestCache, err := NewDigestCache(10, time.Minute)
+					Expect(err).ToNot(HaveOccurred())
+					ctrl.SetDigestCache(digestCache)
+					for i := 0; i < 2; i++ {
+						w = httptest.NewRecorder()
+						req := newFakeRequest("registry.ng.bluemix.net/hello")
+						wh.HandleAdmissionRequest(w, req)
+						parseResponse()
+						Expect(resp.Response.Allowed).To(BeTrue())
+						Expect(string(resp.Response.Patch)).To(ContainSubstring("registry.ng.bluemix.net/hello:latest@sha256:31323334353637383930"))
+					}
+					Expect(trust.GetNotaryRepoArgsForCall).To(HaveLen(1))
+				})
+			})
+
+			Context("if `trust is enabled` and the notary server rejects the token", func() {
+				It("should discard the token and retry with a new one", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					signedNotary := trust
+					trust = &fakenotary.FakeNotary{}
+					trust.GetNotaryRepoStub = func(server, image, notaryToken string) (notaryclient.Repository, error) {
+						if notaryToken == "token" {
+							return nil, fmt.Errorf("401")
+						}
+						return signedNotary.GetNotaryRepo(server, image, notaryToken)
+					}
+					cr.GetContentTrustTokenStub = func(username, password, imageRepo, hostname, notaryURL string) (string, error) {
+						if cr.InvalidateContentTrustTokenCallCount() == 0 {
+							return "token", nil
+						}
+						return "new-token", nil
+					}
+					updateController()
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeTrue())
+					Expect(string(resp.Response.Patch)).To(ContainSubstring("registry.ng.bluemix.net/hello:latest@sha256:31323334353637383930"))
+					Expect(cr.InvalidateContentTrustTokenCallCount()).To(Equal(1))
+				})
+			})
+
 			Context("if `trust is enabled`, and there is a signed image", func() {
 				It("should mutate and allow the image", func() {
 					imageRepos := `"repositories": [
@@ -431,6 +533,52 @@ var _ = Describe("Main", func() {
 					Expect(string(resp.Response.Patch)).To(ContainSubstring("registry.ng.bluemix.net/hello:latest@sha256:31323334353637383930"))
 					Expect(resp.Response.Allowed).To(BeTrue())
 				})
+
+				It("should warn that the image was pinned to the signed digest", func() {
+					imageRepos := `"repositories": [
+							{
+								"name": "registry.ng.bluemix.net/*",
+								"policy": {
+									"trust": {
+										"enabled": true
+									}
+								}
+							}
+						]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					updateController()
+					response := ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Expect(response.Allowed).To(BeTrue())
+					Expect(response.Warnings).To(ConsistOf(`image "registry.ng.bluemix.net/hello" was pinned to signed digest sha256:31323334353637383930`))
+					Expect(response.AuditAnnotations).To(HaveKeyWithValue("containers.0.digest", "sha256:31323334353637383930"))
+					Expect(response.AuditAnnotations).To(HaveKeyWithValue("containers.0.policy", `ImagePolicy default/namespace-policy repository "registry.ng.bluemix.net/*"`))
+				})
+
+				It("should record an event if events are enabled", func() {
+					imageRepos := `"repositories": [
+							{
+								"name": "registry.ng.bluemix.net/*",
+								"policy": {
+									"trust": {
+										"enabled": true
+									}
+								}
+							}
+						]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					updateController()
+					ctrl.SetRecordEvents(true)
+					ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Eventually(func() int {
+						events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+						return len(events.Items)
+					}).Should(Equal(1))
+					events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+					Expect(events.Items[0].Reason).To(Equal(EventReasonImageMutated))
+					Expect(events.Items[0].Type).To(Equal(corev1.EventTypeNormal))
+				})
 			})
 
 			Context("if `trust is enabled`, and there is a signed image", func() {
@@ -589,7 +737,7 @@ var _ = Describe("Main", func() {
 					Expect(len(trust.GetNotaryRepoArgsForCall)).To(Equal(1))
 					Expect(trust.GetNotaryRepoArgsForCall[0].Server).To(Equal("https://registry.ng.bluemix.net:4443"))
 					Expect(resp.Response.Allowed).To(BeFalse())
-					Expect(resp.Response.Result.Message).To(BeIdenticalTo("\n" + `Deny "registry.ng.bluemix.net/hello", failed to get content trust information: unable to reach trust server at this time: 0.`))
+					Expect(resp.Response.Result.Message).To(BeIdenticalTo("\n" + `Deny "registry.ng.bluemix.net/hello", failed to get content trust information: unable to reach trust server at this time: 0., matched ImagePolicy default/namespace-policy repository "registry.ng.bluemix.net/*"`))
 				})
 			})
 
@@ -620,7 +768,7 @@ var _ = Describe("Main", func() {
 					Expect(len(trust.GetNotaryRepoArgsForCall)).To(Equal(1))
 					Expect(trust.GetNotaryRepoArgsForCall[0].Server).To(Equal("https://some-trust-server.com:4443"))
 					Expect(resp.Response.Allowed).To(BeFalse())
-					Expect(resp.Response.Result.Message).To(BeIdenticalTo("\n" + `Deny "registry.ng.bluemix.net/hello", failed to get content trust information: unable to reach trust server at this time: 0.`))
+					Expect(resp.Response.Result.Message).To(BeIdenticalTo("\n" + `Deny "registry.ng.bluemix.net/hello", failed to get content trust information: unable to reach trust server at this time: 0., matched ImagePolicy default/namespace-policy repository "registry.ng.bluemix.net/*"`))
 				})
 			})
 
@@ -841,6 +989,383 @@ var _ = Describe("Main", func() {
 				})
 			})
 
+			Context("if `va is enabled` and the image has no vulnerabilities", func() {
+				It("should allow the image", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": false
+								},
+								"va": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					scanner.GetReportReturns(&va.Report{}, nil)
+					updateController()
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeTrue())
+					Expect(cr.GetDigestCallCount()).To(Equal(1))
+					_, _, repository, tag, registryURL := cr.GetDigestArgsForCall(0)
+					Expect(repository).To(Equal("hello"))
+					Expect(tag).To(Equal("latest"))
+					Expect(registryURL).To(Equal("https://registry.ng.bluemix.net"))
+					Expect(scanner.GetReportCallCount()).To(Equal(1))
+					image, digest := scanner.GetReportArgsForCall(0)
+					Expect(image).To(Equal("registry.ng.bluemix.net/hello:latest"))
+					Expect(digest).To(Equal("sha256:6162636465666768696a"))
+					Expect(string(resp.Response.Patch)).To(ContainSubstring("registry.ng.bluemix.net/hello:latest@sha256:6162636465666768696a"))
+					Expect(resp.Response.AuditAnnotations).To(HaveKeyWithValue("containers.0.digest", "sha256:6162636465666768696a"))
+				})
+			})
+
+			Context("if `va is enabled` and the tag cannot be resolved to a digest", func() {
+				It("should deny the image without checking the tag", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"va": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					cr.GetDigestReturns("", fmt.Errorf("FAKE_MANIFEST_NOT_FOUND"))
+					updateController()
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeFalse())
+					Expect(resp.Response.Result.Message).To(ContainSubstring("failed to resolve the image to a digest to check for vulnerabilities: FAKE_MANIFEST_NOT_FOUND"))
+					Expect(scanner.GetReportCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("if `va is enabled` and the image has vulnerabilities above the threshold", func() {
+				It("should deny the image and list the vulnerabilities", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": false
+								},
+								"va": {
+									"enabled": true,
+									"threshold": "medium",
+									"exemptions": ["CVE-2018-0003"]
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					scanner.GetReportReturns(&va.Report{
+						Vulnerabilities: []va.Vulnerability{
+							{ID: "CVE-2018-0001", Severity: va.SeverityLow},
+							{ID: "CVE-2018-0002", Severity: va.SeverityMedium},
+							{ID: "CVE-2018-0003", Severity: va.SeverityCritical},
+						},
+					}, nil)
+					updateController()
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeFalse())
+					Expect(resp.Response.Result.Message).To(ContainSubstring("CVE-2018-0002 (medium)"))
+					Expect(resp.Response.Result.Message).ToNot(ContainSubstring("CVE-2018-0001"))
+					Expect(resp.Response.Result.Message).ToNot(ContainSubstring("CVE-2018-0003"))
+				})
+			})
+
+			Context("if `va is enabled` and there is no report for the image", func() {
+				It("should deny the image", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"va": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					scanner.GetReportReturns(nil, va.ErrReportNotFound)
+					updateController()
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeFalse())
+					Expect(resp.Response.Result.Message).To(ContainSubstring("failed to get vulnerability report"))
+				})
+			})
+
+			Context("if `va is enabled` and the threshold is invalid", func() {
+				It("should deny the image", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"va": {
+									"enabled": true,
+									"threshold": "severe"
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					updateController()
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeFalse())
+					Expect(resp.Response.Result.Message).To(ContainSubstring(`invalid vulnerability threshold "severe"`))
+					Expect(scanner.GetReportCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("if `va is enabled` but no scanner is configured", func() {
+				It("should deny the image", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"va": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					ctrl = NewController(kubeWrapper, policyClient, trust, cr, nil)
+					wh = webhook.NewServer("notary", ctrl, []byte{}, []byte{})
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeFalse())
+					Expect(resp.Response.Result.Message).To(ContainSubstring("no vulnerability scanner is configured"))
+				})
+			})
+
+			Context("if `trust is enabled` and `va is enabled`", func() {
+				It("should check the signed digest for vulnerabilities", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": true
+								},
+								"va": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					scanner.GetReportReturns(&va.Report{}, nil)
+					updateController()
+					req := newFakeRequest("registry.ng.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeTrue())
+					Expect(string(resp.Response.Patch)).To(ContainSubstring("registry.ng.bluemix.net/hello:latest@sha256:31323334353637383930"))
+					Expect(scanner.GetReportCallCount()).To(Equal(1))
+					_, digest := scanner.GetReportArgsForCall(0)
+					Expect(digest).To(Equal("sha256:31323334353637383930"))
+				})
+			})
+
+			Context("if `trust is enabled` in warn mode and there is not a signed image", func() {
+				It("should allow the image with a warning and record an event", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"enforcementMode": "warn",
+								"trust": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					trust = &fakenotary.FakeNotary{}
+					trust.GetNotaryRepoReturns(nil, fmt.Errorf("FAKE_NO_SIGNED_IMAGE_ERROR"))
+					updateController()
+					ctrl.SetRecordEvents(true)
+					response := ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Expect(response.Allowed).To(BeTrue())
+					Expect(response.Patch).To(BeEmpty())
+					Expect(response.Warnings).To(HaveLen(1))
+					Expect(response.Warnings[0]).To(ContainSubstring("FAKE_NO_SIGNED_IMAGE_ERROR"))
+					Expect(response.Warnings[0]).To(ContainSubstring("policy is in warn mode"))
+					Eventually(func() int {
+						events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+						return len(events.Items)
+					}).Should(Equal(1))
+					events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+					Expect(events.Items[0].Reason).To(Equal(EventReasonUnenforcedDenial))
+					Expect(events.Items[0].InvolvedObject.Kind).To(Equal("Pod"))
+				})
+			})
+
+			Context("if `trust is enabled` in audit mode and there is not a signed image", func() {
+				It("should allow the image without a warning and record an event", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"enforcementMode": "audit",
+								"trust": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					trust = &fakenotary.FakeNotary{}
+					trust.GetNotaryRepoReturns(nil, fmt.Errorf("FAKE_NO_SIGNED_IMAGE_ERROR"))
+					updateController()
+					ctrl.SetRecordEvents(true)
+					response := ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Expect(response.Allowed).To(BeTrue())
+					Expect(response.Warnings).To(BeEmpty())
+					Expect(response.AuditAnnotations).To(HaveKeyWithValue("unenforced-denial-1", ContainSubstring("policy is in audit mode")))
+					Eventually(func() int {
+						events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+						return len(events.Items)
+					}).Should(Equal(1))
+				})
+
+				It("should not record an event if events are disabled", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"enforcementMode": "audit",
+								"trust": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					trust = &fakenotary.FakeNotary{}
+					trust.GetNotaryRepoReturns(nil, fmt.Errorf("FAKE_NO_SIGNED_IMAGE_ERROR"))
+					updateController()
+					response := ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Expect(response.Allowed).To(BeTrue())
+					Consistently(func() int {
+						events, _ := kubeClientset.CoreV1().Events(namespace).List(metav1.ListOptions{})
+						return len(events.Items)
+					}).Should(Equal(0))
+				})
+			})
+
+			Context("if an image is allowed in audit mode and a later image has no valid ImagePullSecret", func() {
+				It("should deny the later image", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"enforcementMode": "audit",
+								"trust": {
+									"enabled": true
+								}
+							}
+						},
+						{
+							"name": "registry.no-secret.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": true
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					trust = &fakenotary.FakeNotary{}
+					trust.GetNotaryRepoReturns(nil, fmt.Errorf("FAKE_NO_SIGNED_IMAGE_ERROR"))
+					updateController()
+					req := newFakeRequestMultiContainer("registry.ng.bluemix.net/hello", "registry.no-secret.bluemix.net/hello")
+					wh.HandleAdmissionRequest(w, req)
+					parseResponse()
+					Expect(resp.Response.Allowed).To(BeFalse())
+					Expect(resp.Response.Result.Message).To(ContainSubstring(`Deny "registry.no-secret.bluemix.net/hello", no valid ImagePullSecret defined for registry.no-secret.bluemix.net`))
+				})
+			})
+
+			Context("if the repository is denied", func() {
+				It("should deny the image with the message of the repository", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "*"
+						},
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"deny": true,
+							"message": "use the internal mirror"
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					trust = &fakenotary.FakeNotary{}
+					updateController()
+					response := ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Expect(response.Allowed).To(BeFalse())
+					Expect(response.Result.Message).To(ContainSubstring(`Deny "registry.ng.bluemix.net/hello", the repository is denied: use the internal mirror`))
+					Expect(response.Result.Message).To(ContainSubstring(`matched ImagePolicy default/namespace-policy repository "registry.ng.bluemix.net/*"`))
+					Expect(trust.GetNotaryRepoCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("if the policy forbids the tag of the image", func() {
+				It("should deny the image before checking trust", func() {
+					imageRepos := `"repositories": [
+						{
+							"name": "registry.ng.bluemix.net/*",
+							"policy": {
+								"trust": {
+									"enabled": true
+								},
+								"tags": {
+									"forbidden": ["latest"]
+								}
+							}
+						}
+					]`
+					clusterRepos := `"repositories": []`
+					fakeEnforcer(imageRepos, clusterRepos)
+					trust = &fakenotary.FakeNotary{}
+					updateController()
+					response := ctrl.Admit(newFakeAdmissionRequest("registry.ng.bluemix.net/hello"))
+					Expect(response.Allowed).To(BeFalse())
+					Expect(response.Result.Message).To(ContainSubstring(`Deny "registry.ng.bluemix.net/hello", tag "latest" is forbidden by pattern "latest"`))
+					Expect(response.AuditAnnotations).To(HaveKeyWithValue("containers.0.denied", ContainSubstring(`tag "latest" is forbidden`)))
+					Expect(trust.GetNotaryRepoCallCount()).To(Equal(0))
+				})
+			})
+
 		})
 	})
 })
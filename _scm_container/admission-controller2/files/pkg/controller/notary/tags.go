@@ -0,0 +1,59 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"fmt"
+
+	"admission-controller2/helpers/image"
+	"admission-controller2/helpers/wildcard"
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
+	"admission-controller2/pkg/metrics"
+)
+
+// checkTags checks the tag and digest of the image against the tag constraints of the policy
+// It returns the reason and message to deny the image with, or empty strings if the image is allowed
+// Images specified only by digest have no tag, so the tag patterns do not apply to them
+func checkTags(img *image.Reference, policy *securityenforcementv1beta1.Policy) (string, string) {
+	if policy == nil {
+		return "", ""
+	}
+
+	if policy.Tags.RequireDigest && img.GetDigest() == "" {
+		return metrics.ReasonDigestRequired, fmt.Sprintf("Deny %q, the policy requires images to be specified by digest", img.String())
+	}
+
+	if img.GetDigest() != "" && !img.HasTag() {
+		// The image is pinned by digest, it does not have the latest tag it is given when it has no tag
+		return "", ""
+	}
+
+	tag := img.GetTag()
+	for _, pattern := range policy.Tags.Forbidden {
+		if wildcard.Compare(pattern, tag) {
+			return metrics.ReasonTag, fmt.Sprintf("Deny %q, tag %q is forbidden by pattern %q", img.String(), tag, pattern)
+		}
+	}
+
+	if len(policy.Tags.Allowed) == 0 {
+		return "", ""
+	}
+	for _, pattern := range policy.Tags.Allowed {
+		if wildcard.Compare(pattern, tag) {
+			return "", ""
+		}
+	}
+	return metrics.ReasonTag, fmt.Sprintf("Deny %q, tag %q does not match any of the allowed tag patterns %q", img.String(), tag, policy.Tags.Allowed)
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"admission-controller2/helpers/image"
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
+	"admission-controller2/pkg/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("checkTags", func() {
+
+	check := func(name string, tags securityenforcementv1beta1.Tags) (string, string) {
+		img, err := image.NewReference(name)
+		Expect(err).ToNot(HaveOccurred())
+		return checkTags(img, &securityenforcementv1beta1.Policy{Tags: tags})
+	}
+
+	It("should allow any image without tag constraints", func() {
+		reason, denial := check("test.com/hello", securityenforcementv1beta1.Tags{})
+		Expect(reason).To(BeEmpty())
+		Expect(denial).To(BeEmpty())
+	})
+
+	It("should deny a forbidden tag", func() {
+		reason, denial := check("test.com/hello:latest", securityenforcementv1beta1.Tags{Forbidden: []string{"latest"}})
+		Expect(reason).To(Equal(metrics.ReasonTag))
+		Expect(denial).To(Equal(`Deny "test.com/hello:latest", tag "latest" is forbidden by pattern "latest"`))
+	})
+
+	It("should treat an image without a tag as latest", func() {
+		_, denial := check("test.com/hello", securityenforcementv1beta1.Tags{Forbidden: []string{"latest"}})
+		Expect(denial).To(ContainSubstring(`tag "latest" is forbidden`))
+	})
+
+	It("should not apply tag patterns to an image specified only by digest", func() {
+		tags := securityenforcementv1beta1.Tags{Forbidden: []string{"latest"}, Allowed: []string{"v*"}, RequireDigest: true}
+		reason, denial := check("test.com/hello@sha256:0123456789abcdef", tags)
+		Expect(reason).To(BeEmpty())
+		Expect(denial).To(BeEmpty())
+	})
+
+	It("should apply tag patterns to the tag of an image with a tag and a digest", func() {
+		_, denial := check("test.com/hello:latest@sha256:0123456789abcdef", securityenforcementv1beta1.Tags{Forbidden: []string{"latest"}})
+		Expect(denial).To(ContainSubstring(`tag "latest" is forbidden`))
+	})
+
+	It("should allow a tag matching an allowed pattern", func() {
+		_, denial := check("test.com/hello:v1.2.3", securityenforcementv1beta1.Tags{Allowed: []string{"release-*", "v*.*.*"}})
+		Expect(denial).To(BeEmpty())
+	})
+
+	It("should deny a tag not matching any allowed pattern", func() {
+		reason, denial := check("test.com/hello:dev", securityenforcementv1beta1.Tags{Allowed: []string{"v*.*.*"}})
+		Expect(reason).To(Equal(metrics.ReasonTag))
+		Expect(denial).To(Equal(`Deny "test.com/hello:dev", tag "dev" does not match any of the allowed tag patterns ["v*.*.*"]`))
+	})
+
+	It("should deny a forbidden tag that also matches an allowed pattern", func() {
+		_, denial := check("test.com/hello:v1.0.0-rc", securityenforcementv1beta1.Tags{Allowed: []string{"v*"}, Forbidden: []string{"*-rc"}})
+		Expect(denial).To(ContainSubstring(`forbidden by pattern "*-rc"`))
+	})
+
+	It("should deny an image without a digest when a digest is required", func() {
+		reason, denial := check("test.com/hello:v1", securityenforcementv1beta1.Tags{RequireDigest: true})
+		Expect(reason).To(Equal(metrics.ReasonDigestRequired))
+		Expect(denial).To(Equal(`Deny "test.com/hello:v1", the policy requires images to be specified by digest`))
+	})
+
+	It("should allow an image with a digest when a digest is required", func() {
+		_, denial := check("test.com/hello:v1@sha256:31323334353637383930", securityenforcementv1beta1.Tags{RequireDigest: true})
+		Expect(denial).To(BeEmpty())
+	})
+})
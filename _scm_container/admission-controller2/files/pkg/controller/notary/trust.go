@@ -17,10 +17,15 @@ package notary
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"path"
+	"strings"
+	"time"
 
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
 	"github.com/golang/glog"
+	notaryclient "github.com/theupdateframework/notary/client"
 	"github.com/theupdateframework/notary/tuf/data"
 	"github.com/theupdateframework/notary/tuf/utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -28,7 +33,11 @@ import (
 
 var releasesRole = data.RoleName(path.Join(data.CanonicalTargetsRole.String(), "releases"))
 
+// notAfterHeader is the PEM header that retires a public key after the RFC 3339 time it holds e.g. Not-After: 2019-01-31T00:00:00Z
+const notAfterHeader = "Not-After"
+
 // Signer struct holds the signer and publicKey from a SignerSecret
+// publicKey may be a bundle of several PEM public keys so that the signer's key can be rotated
 type Signer struct {
 	signer    string
 	publicKey string
@@ -39,11 +48,18 @@ type foundSigner struct {
 	signer Signer
 }
 
-// getDigest .
-func (c *Controller) getDigest(server, image, notaryToken, targetName string, signers []Signer) (*bytes.Buffer, error) {
+// signerGroup is a group of signers of which at least threshold must have signed the image
+type signerGroup struct {
+	signers   []Signer
+	threshold int
+}
+
+// getDigest returns the hex encoded digest of the signed image, and the delegation roles of the members of groups that signed it
+// Every one of signers, and the threshold of every one of groups, must have signed the digest
+func (c *Controller) getDigest(server, image, notaryToken, targetName string, signers []Signer, groups []signerGroup) (*bytes.Buffer, []string, error) {
 	repo, err := c.trust.GetNotaryRepo(server, image, notaryToken)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	roleNames := make([]string, len(signers))
@@ -62,11 +78,11 @@ func (c *Controller) getDigest(server, image, notaryToken, targetName string, si
 	targets, err := repo.GetAllTargetMetadataByName(targetName)
 	if err != nil {
 		glog.Infof("GetAllTargetMetadataByName returned err: %+v", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(targets) == 0 {
-		return nil, fmt.Errorf("No signed targets found")
+		return nil, nil, fmt.Errorf("No signed targets found")
 	}
 
 	var digest []byte // holds digest of the signed image
@@ -86,25 +102,23 @@ func (c *Controller) getDigest(server, image, notaryToken, targetName string, si
 			// See if a signer was specified for this target
 			if role, ok := foundSignerByRole[target.Role.Name]; ok {
 				if role.signer.publicKey != "" {
-					// Assuming public key is in PEM format and not encoded any further
-					keyFromConfig, err := utils.ParsePEMPublicKey([]byte(role.signer.publicKey))
+					keyIDs, err := role.signer.keyIDs(time.Now())
 					if err != nil {
-						return nil, err
+						return nil, nil, err
 					}
-					if _, ok := target.Role.BaseRole.Keys[keyFromConfig.ID()]; !ok {
-						glog.Infof("Key %s not found in role key list: %+v", keyFromConfig.ID(), target.Role.BaseRole.ListKeyIDs())
-						return nil, fmt.Errorf("Public keys are different")
+					if !hasKey(target.Role.BaseRole, keyIDs) {
+						return nil, nil, fmt.Errorf("Public keys are different")
 					}
 					// We found a matching KeyID, so mark the role found in the map.
 					role.found = true
 				} else {
 					glog.Infof("PublicKey not found in role %s", role.signer.signer)
-					return nil, fmt.Errorf("PublicKey not found in role %s", role.signer.signer)
+					return nil, nil, fmt.Errorf("PublicKey not found in role %s", role.signer.signer)
 				}
 
 				// verify that the digest is consistent between all of the roles that we care about
 				if !bytes.Equal(digest, target.Target.Hashes["sha256"]) {
-					return nil, fmt.Errorf("Incompatible digest")
+					return nil, nil, fmt.Errorf("Incompatible digest")
 				}
 			}
 		}
@@ -112,12 +126,260 @@ func (c *Controller) getDigest(server, image, notaryToken, targetName string, si
 		// Now iterate over the signers to make sure we hit them all going over targets
 		for _, role := range foundSignerByRole {
 			if !role.found {
-				return nil, fmt.Errorf("no signature found for role %s", role.signer.signer)
+				return nil, nil, fmt.Errorf("no signature found for role %s", role.signer.signer)
+			}
+		}
+	}
+
+	var groupSigners []string
+	if len(groups) > 0 {
+		digest, groupSigners, err = verifySignerGroups(targets, digest, groups)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return bytes.NewBufferString(hex.EncodeToString(digest)), groupSigners, nil
+}
+
+// verifySignerGroups returns the digest that enough of the signers of every group have signed, and the delegation roles of the signers that signed it
+// If there is a released digest it is the one that must have been signed, otherwise any digest that every group agrees on is used
+func verifySignerGroups(targets []notaryclient.TargetSignedStruct, released []byte, groups []signerGroup) ([]byte, []string, error) {
+	candidates := [][]byte{released}
+	if released == nil {
+		candidates = signedDigests(targets)
+	}
+
+	err := fmt.Errorf("No signed digests found")
+	for _, candidate := range candidates {
+		var signedBy []string
+		if signedBy, err = checkSignerGroups(targets, candidate, groups); err == nil {
+			return candidate, signedBy, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// signedDigests returns each of the distinct digests in the targets
+func signedDigests(targets []notaryclient.TargetSignedStruct) [][]byte {
+	digests := [][]byte{}
+	for _, target := range targets {
+		digest := target.Target.Hashes["sha256"]
+		found := digest == nil
+		for _, seen := range digests {
+			found = found || bytes.Equal(seen, digest)
+		}
+		if !found {
+			digests = append(digests, digest)
+		}
+	}
+	return digests
+}
+
+// checkSignerGroups checks that at least the threshold of every group signed the digest, with a key the signer's public key matches
+// A signer counts once however many times it is listed, and the error lists the signers that were missing
+// It returns the delegation roles of the signers of all of the groups that signed the digest
+func checkSignerGroups(targets []notaryclient.TargetSignedStruct, digest []byte, groups []signerGroup) ([]string, error) {
+	signedBy := []string{}
+	for _, group := range groups {
+		signed := map[data.RoleName]bool{}
+		missing := []string{}
+		roles := []string{}
+		for _, signer := range group.signers {
+			role := data.RoleName(path.Join(data.CanonicalTargetsRole.String(), signer.signer))
+			if _, seen := signed[role]; seen {
+				continue
+			}
+			roles = append(roles, role.String())
+			keyIDs, err := signer.keyIDs(time.Now())
+			if err != nil {
+				return nil, err
+			}
+			signed[role] = roleSignedDigest(targets, role, keyIDs, digest)
+			if !signed[role] {
+				missing = append(missing, role.String())
+			} else if !contains(signedBy, role.String()) {
+				signedBy = append(signedBy, role.String())
 			}
 		}
+
+		count := len(roles) - len(missing)
+		if count < group.threshold {
+			return nil, fmt.Errorf("%d of the signers %s must sign digest %s, %d did, missing signatures from %s",
+				group.threshold, strings.Join(roles, ","), hex.EncodeToString(digest), count, strings.Join(missing, ","))
+		}
+	}
+	return signedBy, nil
+}
+
+// roleSignedDigest returns true if the role signed the digest with one of the keys
+func roleSignedDigest(targets []notaryclient.TargetSignedStruct, role data.RoleName, keyIDs []string, digest []byte) bool {
+	for _, target := range targets {
+		if target.Role.Name == role && hasKey(target.Role.BaseRole, keyIDs) && bytes.Equal(digest, target.Target.Hashes["sha256"]) {
+			return true
+		}
 	}
+	return false
+}
 
-	return bytes.NewBufferString(hex.EncodeToString(digest)), nil
+// keyIDs parses the public keys of the signer and returns the key IDs of those that are not retired at now
+// The public keys are in PEM format and not encoded any further, however the signer was specified
+// A key with a Not-After header is retired after that time, so that signatures made with it are no longer accepted once the key has been rotated
+func (s Signer) keyIDs(now time.Time) ([]string, error) {
+	keyIDs := []string{}
+	found := false
+	rest := []byte(s.publicKey)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		found = true
+
+		if notAfter, ok := block.Headers[notAfterHeader]; ok {
+			retired, err := time.Parse(time.RFC3339, notAfter)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s header in a public key of signer %s: %v", notAfterHeader, s.signer, err)
+			}
+			if now.After(retired) {
+				glog.Infof("Ignoring a public key of signer %s that was retired at %s", s.signer, notAfter)
+				continue
+			}
+		}
+
+		// The headers are not part of the key, drop them so that they don't affect parsing
+		key, err := utils.ParsePEMPublicKey(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes}))
+		if err != nil {
+			return nil, err
+		}
+		keyIDs = append(keyIDs, key.ID())
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no valid public key found")
+	}
+	if len(keyIDs) == 0 {
+		return nil, fmt.Errorf("every public key of signer %s is retired", s.signer)
+	}
+	return keyIDs, nil
+}
+
+// hasKey returns true if any of the key IDs is one of the keys of the role
+func hasKey(role data.BaseRole, keyIDs []string) bool {
+	for _, keyID := range keyIDs {
+		if _, ok := role.Keys[keyID]; ok {
+			return true
+		}
+	}
+	glog.Infof("Keys %v not found in role %s key list: %+v", keyIDs, role.Name, role.ListKeyIDs())
+	return false
+}
+
+// signerRoles returns the comma separated delegation roles of the signers and of the members of signer groups that signed
+func signerRoles(signers []Signer, groupSigners []string) string {
+	roles := make([]string, len(signers))
+	for i, signer := range signers {
+		roles[i] = path.Join(data.CanonicalTargetsRole.String(), signer.signer)
+	}
+	for _, role := range groupSigners {
+		if !contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return strings.Join(roles, ",")
+}
+
+// contains returns true if the value is in the list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getSignerGroups retrieves the signers of each of the signer groups of the policy
+func (c *Controller) getSignerGroups(namespace string, match *securityenforcementv1beta1.PolicyMatch, groups []securityenforcementv1beta1.SignerGroup) ([]signerGroup, error) {
+	signerGroups := make([]signerGroup, len(groups))
+	for i, group := range groups {
+		refs := group.DistinctSignerSecrets()
+		threshold := group.GetThreshold()
+		if threshold > len(refs) {
+			return nil, fmt.Errorf("signer group %d requires %d signers but only has %d", i, threshold, len(refs))
+		}
+		signers := make([]Signer, len(refs))
+		for j, ref := range refs {
+			signer, err := c.getSigner(namespace, match, ref)
+			if err != nil {
+				return nil, err
+			}
+			signers[j] = signer
+		}
+		signerGroups[i] = signerGroup{signers: signers, threshold: threshold}
+	}
+	return signerGroups, nil
+}
+
+// getSigner retrieves a signer of the policy, namespace is the namespace of the workload
+// Secrets and ConfigMaps in another namespace may only be referred to by ClusterImagePolicies
+func (c *Controller) getSigner(namespace string, match *securityenforcementv1beta1.PolicyMatch, ref securityenforcementv1beta1.Signer) (Signer, error) {
+	if ref.PublicKey != "" {
+		if ref.SignerName == "" {
+			return Signer{}, fmt.Errorf("signerName of the inline publicKey is empty")
+		}
+		return Signer{signer: ref.SignerName, publicKey: ref.PublicKey}, nil
+	}
+
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		if !declaredByClusterImagePolicy(match, ref) {
+			return Signer{}, fmt.Errorf("%s is in another namespace, only a ClusterImagePolicy may refer to it", ref)
+		}
+		namespace = ref.Namespace
+	}
+	if ref.ConfigMap != "" {
+		return c.getSignerConfigMap(namespace, ref.ConfigMap)
+	}
+	return c.getSignerSecret(namespace, ref.Name)
+}
+
+// declaredByClusterImagePolicy returns true if the signer is one of a ClusterImagePolicy's, either the matched policy or its floor
+func declaredByClusterImagePolicy(match *securityenforcementv1beta1.PolicyMatch, ref securityenforcementv1beta1.Signer) bool {
+	if match.Kind == securityenforcementv1beta1.ClusterImagePolicyKind {
+		return true
+	}
+	if match.Floor == nil {
+		return false
+	}
+	floorTrust := match.Floor.Trust
+	signers := append([]securityenforcementv1beta1.Signer(nil), floorTrust.SignerSecrets...)
+	for _, group := range floorTrust.SignerGroups {
+		signers = append(signers, group.SignerSecrets...)
+	}
+	for _, signer := range signers {
+		if signer == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// Retrieve the username and public key for the given namespace/configmap
+func (c *Controller) getSignerConfigMap(namespace, signerConfigMapName string) (Signer, error) {
+	configMap, err := c.kubeClientsetWrapper.CoreV1().ConfigMaps(namespace).Get(signerConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		glog.Error("Error: ", err)
+		return Signer{}, err
+	}
+
+	signer := configMap.Data["name"]
+	publicKey := configMap.Data["publicKey"]
+
+	if signer == "" || publicKey == "" {
+		return Signer{}, fmt.Errorf("name or publicKey field in configmap %s is empty", signerConfigMapName)
+	}
+
+	return Signer{signer: signer, publicKey: publicKey}, nil
 }
 
 // Retrieve the username and public key for the given namespace/secret
@@ -16,7 +16,9 @@ package notary
 
 import (
 	"fmt"
+	"strings"
 
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
 	"admission-controller2/pkg/kubernetes"
 	"admission-controller2/pkg/notary/fakenotary"
 	. "github.com/onsi/ginkgo"
@@ -66,8 +68,8 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 
 		It("should return an error if it fails to get the repo", func() {
 			trust.GetNotaryRepoReturns(nil, fakeErr)
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-			_, err := ctrl.getDigest(server, image, notaryToken, targetName, nil)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+			_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring(fakeErrorMessage))
 		})
@@ -75,8 +77,8 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 		It("should return an error if it fails to get the target by name", func() {
 			fakeRepo.GetAllTargetMetadataByNameReturns(nil, fakeErr)
 			trust.GetNotaryRepoReturns(fakeRepo, nil)
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-			_, err := ctrl.getDigest(server, image, notaryToken, targetName, nil)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+			_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring(fakeErrorMessage))
 		})
@@ -84,8 +86,8 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 		It("should return an error if there are not targets", func() {
 			fakeRepo.GetAllTargetMetadataByNameReturns([]notaryclient.TargetSignedStruct{}, nil)
 			trust.GetNotaryRepoReturns(fakeRepo, nil)
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-			_, err := ctrl.getDigest(server, image, notaryToken, targetName, nil)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+			_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("No signed targets found"))
 		})
@@ -107,8 +109,8 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 					},
 				}, nil)
 				trust.GetNotaryRepoReturns(fakeRepo, nil)
-				ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-				digest, err := ctrl.getDigest(server, image, notaryToken, targetName, nil)
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				digest, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, nil)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(digest.String()).To(Equal("31323334353637383930"))
 			})
@@ -142,13 +144,13 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 					},
 				}, nil)
 				trust.GetNotaryRepoReturns(fakeRepo, nil)
-				ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-				_, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
 					{
 						signer:    "wibble",
 						publicKey: "invalid signer public key",
 					},
-				})
+				}, nil)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("no valid public key found"))
 			})
@@ -180,13 +182,13 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 					},
 				}, nil)
 				trust.GetNotaryRepoReturns(fakeRepo, nil)
-				ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-				_, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
 					{
 						signer:    "wibble",
 						publicKey: signerPublicKey,
 					},
-				})
+				}, nil)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("Public keys are different"))
 			})
@@ -218,12 +220,12 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 					},
 				}, nil)
 				trust.GetNotaryRepoReturns(fakeRepo, nil)
-				ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-				_, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
 					{
 						signer: "wibble",
 					},
-				})
+				}, nil)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal("PublicKey not found in role wibble"))
 			})
@@ -255,13 +257,13 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 					},
 				}, nil)
 				trust.GetNotaryRepoReturns(fakeRepo, nil)
-				ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-				_, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
 					{
 						// signer: "wibble",
 						publicKey: signerPublicKey,
 					},
-				})
+				}, nil)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("no signature found for role"))
 			})
@@ -293,19 +295,272 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 					},
 				}, nil)
 				trust.GetNotaryRepoReturns(fakeRepo, nil)
-				ctrl = NewController(kubeWrapper, policyClient, trust, cr)
-				digest, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				digest, _, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{
 					{
 						signer:    "wibble",
 						publicKey: signerPublicKey,
 					},
-				})
+				}, nil)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(digest.String()).To(Equal("31323334353637383930"))
 			})
 
 		})
 
+		Context("when the signer has several public keys", func() {
+			var (
+				oldKey     string
+				newKey     string
+				oldKeyID   string
+				newKeyID   string
+				signedWith func(keyID string)
+				getDigest  func(publicKey string) (string, error)
+			)
+
+			BeforeEach(func() {
+				oldKey = signerPublicKey
+				oldKeyID = "261144b64ca3413e7fb3fd509099f1b92df19d4e4158e709fbaa2f8fc22f7191"
+				newKey = `
+-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEndRqq0buyP915t8IaaAFN6RpyR5N
+j7AMeCAyFuJPvQTARcwSxYmceTJ1nV3mEiDmyERKAPAIbJn+igvqqBTXNA==
+-----END PUBLIC KEY-----
+`
+				newKeyID = "0f5c987309c9f83932589bccc39c76e6f7d8e8e66d3142407c2c3cf271266102"
+				signedWith = func(keyID string) {
+					publicKey := data.NewPublicKey("sha256", []byte("abc"))
+					fakeRepo.GetAllTargetMetadataByNameReturns([]notaryclient.TargetSignedStruct{
+						{
+							Target: notaryclient.Target{Hashes: data.Hashes{"sha256": []byte("1234567890")}},
+							Role:   data.DelegationRole{BaseRole: data.BaseRole{Name: "targets/wibble", Keys: map[string]data.PublicKey{keyID: publicKey}}},
+						},
+						{
+							Target: notaryclient.Target{Hashes: data.Hashes{"sha256": []byte("1234567890")}},
+							Role:   data.DelegationRole{BaseRole: data.BaseRole{Name: "targets/releases", Keys: map[string]data.PublicKey{"whatever, don't care": publicKey}}},
+						},
+					}, nil)
+					trust.GetNotaryRepoReturns(fakeRepo, nil)
+				}
+				getDigest = func(publicKey string) (string, error) {
+					ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+					digest, _, err := ctrl.getDigest(server, image, notaryToken, targetName, []Signer{{signer: "wibble", publicKey: publicKey}}, nil)
+					if err != nil {
+						return "", err
+					}
+					return digest.String(), nil
+				}
+			})
+
+			It("should accept a signature made with the new key", func() {
+				signedWith(newKeyID)
+				digest, err := getDigest(oldKey + newKey)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(digest).To(Equal("31323334353637383930"))
+			})
+
+			It("should accept a signature made with the old key", func() {
+				signedWith(oldKeyID)
+				digest, err := getDigest(oldKey + newKey)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(digest).To(Equal("31323334353637383930"))
+			})
+
+			It("should accept a signature made with a key that has not been retired yet", func() {
+				signedWith(oldKeyID)
+				digest, err := getDigest(strings.Replace(oldKey, "KEY-----\n", "KEY-----\nNot-After: 2999-01-01T00:00:00Z\n\n", 1) + newKey)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(digest).To(Equal("31323334353637383930"))
+			})
+
+			It("should not accept a signature made with a retired key", func() {
+				signedWith(oldKeyID)
+				_, err := getDigest(strings.Replace(oldKey, "KEY-----\n", "KEY-----\nNot-After: 2000-01-01T00:00:00Z\n\n", 1) + newKey)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("Public keys are different"))
+			})
+
+			It("should fail if every key is retired", func() {
+				signedWith(oldKeyID)
+				_, err := getDigest(strings.Replace(oldKey, "KEY-----\n", "KEY-----\nNot-After: 2000-01-01T00:00:00Z\n\n", 1))
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("every public key of signer wibble is retired"))
+			})
+
+			It("should fail if the Not-After header is not a time", func() {
+				signedWith(oldKeyID)
+				_, err := getDigest(strings.Replace(oldKey, "KEY-----\n", "KEY-----\nNot-After: tomorrow\n\n", 1))
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(HavePrefix("invalid Not-After header in a public key of signer wibble"))
+			})
+		})
+
+		Context("when there are signer groups", func() {
+			var keyID string
+
+			signedTarget := func(role, keyID, digest string) notaryclient.TargetSignedStruct {
+				return notaryclient.TargetSignedStruct{
+					Target: notaryclient.Target{
+						Hashes: data.Hashes{"sha256": []byte(digest)},
+					},
+					Role: data.DelegationRole{
+						BaseRole: data.BaseRole{
+							Name: data.RoleName(role),
+							Keys: map[string]data.PublicKey{keyID: data.NewPublicKey("sha256", []byte("abc"))},
+						},
+					},
+				}
+			}
+
+			engineers := func(threshold int) []signerGroup {
+				return []signerGroup{
+					{
+						signers: []Signer{
+							{signer: "alice", publicKey: signerPublicKey},
+							{signer: "bob", publicKey: signerPublicKey},
+							{signer: "carol", publicKey: signerPublicKey},
+						},
+						threshold: threshold,
+					},
+				}
+			}
+
+			BeforeEach(func() {
+				keyID = "261144b64ca3413e7fb3fd509099f1b92df19d4e4158e709fbaa2f8fc22f7191"
+			})
+
+			It("should return the digest if enough of the group signed it", func() {
+				fakeRepo.GetAllTargetMetadataByNameReturns([]notaryclient.TargetSignedStruct{
+					signedTarget("targets/releases", "abc", "1234567890"),
+					signedTarget("targets/alice", keyID, "1234567890"),
+					signedTarget("targets/carol", keyID, "1234567890"),
+				}, nil)
+				trust.GetNotaryRepoReturns(fakeRepo, nil)
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				digest, groupSigners, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, engineers(2))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(digest.String()).To(Equal("31323334353637383930"))
+				Expect(groupSigners).To(Equal([]string{"targets/alice", "targets/carol"}))
+			})
+
+			It("should fail and list the missing signers if too few of the group signed", func() {
+				fakeRepo.GetAllTargetMetadataByNameReturns([]notaryclient.TargetSignedStruct{
+					signedTarget("targets/releases", "abc", "1234567890"),
+					signedTarget("targets/alice", keyID, "1234567890"),
+				}, nil)
+				trust.GetNotaryRepoReturns(fakeRepo, nil)
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, engineers(2))
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("2 of the signers targets/alice,targets/bob,targets/carol must sign digest 31323334353637383930, 1 did, missing signatures from targets/bob,targets/carol"))
+			})
+
+			It("should not count signers whose keys do not match or who signed a different digest", func() {
+				fakeRepo.GetAllTargetMetadataByNameReturns([]notaryclient.TargetSignedStruct{
+					signedTarget("targets/releases", "abc", "1234567890"),
+					signedTarget("targets/alice", keyID, "1234567890"),
+					signedTarget("targets/bob", "different key id", "1234567890"),
+					signedTarget("targets/carol", keyID, "0987654321"),
+				}, nil)
+				trust.GetNotaryRepoReturns(fakeRepo, nil)
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, engineers(2))
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("missing signatures from targets/bob,targets/carol"))
+			})
+
+			It("should return the digest the group agrees on if it has not been released", func() {
+				fakeRepo.GetAllTargetMetadataByNameReturns([]notaryclient.TargetSignedStruct{
+					signedTarget("targets/alice", keyID, "0987654321"),
+					signedTarget("targets/bob", keyID, "1234567890"),
+					signedTarget("targets/carol", keyID, "1234567890"),
+				}, nil)
+				trust.GetNotaryRepoReturns(fakeRepo, nil)
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				digest, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, engineers(2))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(digest.String()).To(Equal("31323334353637383930"))
+			})
+
+			It("should fail if a signer of a group that requires all of them did not sign", func() {
+				group := engineers(3)
+				fakeRepo.GetAllTargetMetadataByNameReturns([]notaryclient.TargetSignedStruct{
+					signedTarget("targets/releases", "abc", "1234567890"),
+					signedTarget("targets/alice", keyID, "1234567890"),
+					signedTarget("targets/bob", keyID, "1234567890"),
+				}, nil)
+				trust.GetNotaryRepoReturns(fakeRepo, nil)
+				ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+				_, _, err := ctrl.getDigest(server, image, notaryToken, targetName, nil, group)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("missing signatures from targets/carol"))
+			})
+		})
+
+	})
+
+	Describe("getSignerGroups", func() {
+
+		newSignerSecret := func(name string) *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+				Data: map[string][]byte{
+					"name":      []byte(name),
+					"publicKey": []byte("key"),
+				},
+			}
+		}
+
+		BeforeEach(func() {
+			kubeClientset = k8sfake.NewSimpleClientset(newSignerSecret("alice"), newSignerSecret("bob"))
+			kubeWrapper = kubernetes.NewKubeClientsetWrapper(kubeClientset)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+		})
+
+		match := &securityenforcementv1beta1.PolicyMatch{Kind: securityenforcementv1beta1.ImagePolicyKind}
+
+		It("should return the signers of each group with its threshold", func() {
+			groups, err := ctrl.getSignerGroups(metav1.NamespaceDefault, match, []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{{Name: "alice"}, {Name: "bob"}}, Threshold: 1},
+				{SignerSecrets: []securityenforcementv1beta1.Signer{{Name: "alice"}}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(groups).To(Equal([]signerGroup{
+				{signers: []Signer{{signer: "alice", publicKey: "key"}, {signer: "bob", publicKey: "key"}}, threshold: 1},
+				{signers: []Signer{{signer: "alice", publicKey: "key"}}, threshold: 1},
+			}))
+		})
+
+		It("should return an error if the threshold is more than the number of signers", func() {
+			_, err := ctrl.getSignerGroups(metav1.NamespaceDefault, match, []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{{Name: "alice"}}, Threshold: 2},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("signer group 0 requires 2 signers but only has 1"))
+		})
+
+		It("should count a signer listed twice once", func() {
+			groups, err := ctrl.getSignerGroups(metav1.NamespaceDefault, match, []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{{Name: "alice"}, {Name: "alice"}}},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(groups).To(Equal([]signerGroup{
+				{signers: []Signer{{signer: "alice", publicKey: "key"}}, threshold: 1},
+			}))
+
+			_, err = ctrl.getSignerGroups(metav1.NamespaceDefault, match, []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{{Name: "alice"}, {Name: "alice"}}, Threshold: 2},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("signer group 0 requires 2 signers but only has 1"))
+		})
+
+		It("should return an error if a signer secret is missing", func() {
+			_, err := ctrl.getSignerGroups(metav1.NamespaceDefault, match, []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{{Name: "carol"}}},
+			})
+			Expect(err).To(HaveOccurred())
+		})
 	})
 
 	Describe("getSignerSecret", func() {
@@ -335,7 +590,7 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 		})
 
 		It("should return an error if there is not secret", func() {
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
 			signer, err := ctrl.getSignerSecret(namespace, "no-secret")
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal(`secrets "no-secret" not found`))
@@ -349,7 +604,7 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 			}
 			kubeClientset = k8sfake.NewSimpleClientset(fakeSecret)
 			kubeWrapper = kubernetes.NewKubeClientsetWrapper(kubeClientset)
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
 			signer, err := ctrl.getSignerSecret(namespace, "my-secret")
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("name or publicKey field in secret my-secret is empty"))
@@ -363,7 +618,7 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 			}
 			kubeClientset = k8sfake.NewSimpleClientset(fakeSecret)
 			kubeWrapper = kubernetes.NewKubeClientsetWrapper(kubeClientset)
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
 			signer, err := ctrl.getSignerSecret(namespace, "my-secret")
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("name or publicKey field in secret my-secret is empty"))
@@ -377,11 +632,104 @@ Aaq77T1fhZkFO5uTAgMBAAE=
 			}
 			kubeClientset = k8sfake.NewSimpleClientset(fakeSecret)
 			kubeWrapper = kubernetes.NewKubeClientsetWrapper(kubeClientset)
-			ctrl = NewController(kubeWrapper, policyClient, trust, cr)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
 			signer, err := ctrl.getSignerSecret(namespace, "my-secret")
 			Expect(err).ToNot(HaveOccurred())
 			Expect(signer).To(Equal(Signer{signer: "signer", publicKey: "key"}))
 		})
 	})
 
+	Describe("getSigner", func() {
+
+		var (
+			imagePolicyMatch   *securityenforcementv1beta1.PolicyMatch
+			clusterPolicyMatch *securityenforcementv1beta1.PolicyMatch
+		)
+
+		BeforeEach(func() {
+			kubeClientset = k8sfake.NewSimpleClientset(
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "signer", Namespace: metav1.NamespaceDefault},
+					Data:       map[string][]byte{"name": []byte("local"), "publicKey": []byte("local-key")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "signer", Namespace: "signers"},
+					Data:       map[string][]byte{"name": []byte("shared"), "publicKey": []byte("shared-key")},
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "signer", Namespace: "signers"},
+					Data:       map[string]string{"name": "configmap", "publicKey": "configmap-key"},
+				},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: metav1.NamespaceDefault},
+				},
+			)
+			kubeWrapper = kubernetes.NewKubeClientsetWrapper(kubeClientset)
+			ctrl = NewController(kubeWrapper, policyClient, trust, cr, scanner)
+			imagePolicyMatch = &securityenforcementv1beta1.PolicyMatch{Kind: securityenforcementv1beta1.ImagePolicyKind}
+			clusterPolicyMatch = &securityenforcementv1beta1.PolicyMatch{Kind: securityenforcementv1beta1.ClusterImagePolicyKind}
+		})
+
+		It("should return an inline signer", func() {
+			signer, err := ctrl.getSigner(metav1.NamespaceDefault, imagePolicyMatch, securityenforcementv1beta1.Signer{SignerName: "inline", PublicKey: "inline-key"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signer).To(Equal(Signer{signer: "inline", publicKey: "inline-key"}))
+		})
+
+		It("should return an error for an inline key without a signer name", func() {
+			_, err := ctrl.getSigner(metav1.NamespaceDefault, imagePolicyMatch, securityenforcementv1beta1.Signer{PublicKey: "inline-key"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("signerName of the inline publicKey is empty"))
+		})
+
+		It("should return the signer from a secret in the namespace of the workload", func() {
+			signer, err := ctrl.getSigner(metav1.NamespaceDefault, imagePolicyMatch, securityenforcementv1beta1.Signer{Name: "signer"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signer).To(Equal(Signer{signer: "local", publicKey: "local-key"}))
+		})
+
+		It("should return the signer from a secret in another namespace for a ClusterImagePolicy", func() {
+			signer, err := ctrl.getSigner(metav1.NamespaceDefault, clusterPolicyMatch, securityenforcementv1beta1.Signer{Name: "signer", Namespace: "signers"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signer).To(Equal(Signer{signer: "shared", publicKey: "shared-key"}))
+		})
+
+		It("should return the signer from a configmap in another namespace for a ClusterImagePolicy", func() {
+			signer, err := ctrl.getSigner(metav1.NamespaceDefault, clusterPolicyMatch, securityenforcementv1beta1.Signer{ConfigMap: "signer", Namespace: "signers"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signer).To(Equal(Signer{signer: "configmap", publicKey: "configmap-key"}))
+		})
+
+		It("should not let an ImagePolicy refer to a signer in another namespace", func() {
+			_, err := ctrl.getSigner(metav1.NamespaceDefault, imagePolicyMatch, securityenforcementv1beta1.Signer{Name: "signer", Namespace: "signers"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("secret signers/signer is in another namespace, only a ClusterImagePolicy may refer to it"))
+		})
+
+		It("should let an ImagePolicy use a signer in another namespace that its floor refers to", func() {
+			ref := securityenforcementv1beta1.Signer{ConfigMap: "signer", Namespace: "signers"}
+			imagePolicyMatch.Floor = clusterPolicyMatch
+			imagePolicyMatch.Floor.Trust.SignerGroups = []securityenforcementv1beta1.SignerGroup{{SignerSecrets: []securityenforcementv1beta1.Signer{ref}}}
+			signer, err := ctrl.getSigner(metav1.NamespaceDefault, imagePolicyMatch, ref)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signer).To(Equal(Signer{signer: "configmap", publicKey: "configmap-key"}))
+		})
+
+		It("should return an error if the configmap does not have a name and publicKey", func() {
+			_, err := ctrl.getSigner(metav1.NamespaceDefault, imagePolicyMatch, securityenforcementv1beta1.Signer{ConfigMap: "empty"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("name or publicKey field in configmap empty is empty"))
+		})
+	})
+
+	Describe("signerRoles", func() {
+		It("should return the delegation roles of the signers", func() {
+			Expect(signerRoles([]Signer{{signer: "wibble"}, {signer: "releases"}}, nil)).To(Equal("targets/wibble,targets/releases"))
+		})
+
+		It("should add the group signers that are not already listed", func() {
+			Expect(signerRoles([]Signer{{signer: "wibble"}}, []string{"targets/wibble", "targets/alice"})).To(Equal("targets/wibble,targets/alice"))
+		})
+	})
+
 })
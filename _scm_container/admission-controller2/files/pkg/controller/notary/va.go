@@ -0,0 +1,112 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"admission-controller2/helpers/image"
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
+	"admission-controller2/pkg/metrics"
+	"admission-controller2/pkg/va"
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// checkVulnerabilities retrieves the vulnerability report for the image and checks it against the VA policy
+// digest is the hex encoded sha256 digest of the image, if it is empty the tag is resolved to a digest with the pull secrets
+// so that the report is for the image that will run, and that digest is returned for the image to be pinned to
+// It returns the message to deny the image with, or an empty string if the image is allowed
+func (c *Controller) checkVulnerabilities(namespace string, img *image.Reference, digest string, pullSecrets []corev1.LocalObjectReference, policy *securityenforcementv1beta1.Policy) (resolved string, denial string) {
+	if policy == nil || !(policy.Va.Enabled != nil && *policy.Va.Enabled == true) {
+		return "", ""
+	}
+
+	// VA is enforced
+	glog.Info("VA is enforced")
+
+	if c.scanner == nil {
+		return "", fmt.Sprintf("Deny %q, vulnerability advisor is enabled but no vulnerability scanner is configured", img.String())
+	}
+
+	threshold := policy.Va.Threshold
+	if threshold == "" {
+		threshold = va.DefaultThreshold
+	}
+	if !va.ValidSeverity(threshold) {
+		return "", fmt.Sprintf("Deny %q, invalid vulnerability threshold %q in policy", img.String(), threshold)
+	}
+
+	if digest == "" {
+		var err error
+		if resolved, err = c.resolveDigest(namespace, img, pullSecrets); err != nil {
+			glog.Errorf("Failed to resolve %q to a digest: %v", img.String(), err)
+			return "", fmt.Sprintf("Deny %q, failed to resolve the image to a digest to check for vulnerabilities: %s", img.String(), err.Error())
+		}
+		digest = resolved
+	}
+	start := time.Now()
+	report, err := c.scanner.GetReport(img.NameWithTag(), "sha256:"+digest)
+	metrics.ObserveDependency(metrics.DependencyVA, start, err)
+	if err != nil {
+		glog.Errorf("Failed to get vulnerability report for %q: %v", img.String(), err)
+		return "", fmt.Sprintf("Deny %q, failed to get vulnerability report: %s", img.String(), err.Error())
+	}
+
+	failures := report.Failures(threshold, policy.Va.Exemptions)
+	if len(failures) == 0 {
+		return resolved, ""
+	}
+	ids := make([]string, len(failures))
+	for i, vulnerability := range failures {
+		ids[i] = fmt.Sprintf("%s (%s)", vulnerability.ID, vulnerability.Severity)
+	}
+	return "", fmt.Sprintf("Deny %q, image has %d vulnerabilities with %s or higher severity: %s", img.String(), len(failures), threshold, strings.Join(ids, ", "))
+}
+
+// resolveDigest gets the hex encoded sha256 digest the tag of the image points to from its registry
+// The pull secrets for the registry are tried in turn, then anonymous access for public images
+func (c *Controller) resolveDigest(namespace string, img *image.Reference, pullSecrets []corev1.LocalObjectReference) (string, error) {
+	type credentials struct{ username, password string }
+	var tries []credentials
+	for _, secret := range pullSecrets {
+		username, password, err := c.kubeClientsetWrapper.GetSecretToken(namespace, secret.Name, img.GetHostname())
+		if err != nil {
+			glog.Error(err)
+			continue
+		}
+		tries = append(tries, credentials{username, password})
+	}
+	tries = append(tries, credentials{})
+
+	var err error
+	for _, try := range tries {
+		var digest string
+		start := time.Now()
+		digest, err = c.cr.GetDigest(try.username, try.password, img.RepositoryPath(), img.GetTag(), img.GetRegistryURL())
+		metrics.ObserveDependency(metrics.DependencyRegistry, start, err)
+		if err != nil {
+			glog.Warningf("Failed to get the digest of %q: %v", img.String(), err)
+			continue
+		}
+		if !strings.HasPrefix(digest, "sha256:") {
+			return "", fmt.Errorf("unsupported digest %q", digest)
+		}
+		return strings.TrimPrefix(digest, "sha256:"), nil
+	}
+	return "", err
+}
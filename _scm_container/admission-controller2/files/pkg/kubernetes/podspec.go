@@ -17,8 +17,8 @@ package kubernetes
 import (
 	"fmt"
 
+	"admission-controller2/types"
 	"github.com/golang/glog"
-	"k8s.io/api/admission/v1beta1"
 	appsv1 "k8s.io/api/apps/v1"
 	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	appsv1beta2 "k8s.io/api/apps/v1beta2"
@@ -49,7 +49,7 @@ var ErrObjectHasParents = fmt.Errorf("This object has parents")
 var ErrObjectHasZeroReplicas = fmt.Errorf("This object has zero replicas")
 
 // GetPodSpec retrieves the podspec from the admission request passed in
-func (w *Wrapper) GetPodSpec(ar *v1beta1.AdmissionRequest) (string, *corev1.PodSpec, error) {
+func (w *Wrapper) GetPodSpec(ar *types.AdmissionRequest) (string, *corev1.PodSpec, error) {
 	ps := corev1.PodSpec{}
 	var templateString string
 
@@ -15,7 +15,7 @@
 package kubernetes
 
 import (
-	"k8s.io/api/admission/v1beta1"
+	"admission-controller2/types"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -29,7 +29,7 @@ var _ WrapperInterface = &Wrapper{}
 // WrapperInterface is the interface for a wrapper around kubeclientset that includes some helper functions for applying behaviour to kube resources
 type WrapperInterface interface {
 	kubernetes.Interface
-	GetPodSpec(*v1beta1.AdmissionRequest) (string, *corev1.PodSpec, error)
+	GetPodSpec(*types.AdmissionRequest) (string, *corev1.PodSpec, error)
 	GetSecretToken(namespace, secretName, registry string) (string, string, error)
 }
 
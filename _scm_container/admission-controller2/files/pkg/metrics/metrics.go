@@ -0,0 +1,137 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "portieris"
+
+// Dependencies whose latency and failures are recorded
+const (
+	DependencyPolicy   = "policy"
+	DependencyToken    = "token"
+	DependencyNotary   = "notary"
+	DependencyVA       = "va"
+	DependencyRegistry = "registry"
+)
+
+// Reasons an image is denied
+const (
+	ReasonInvalidImage           = "invalid_image"
+	ReasonPolicy                 = "policy"
+	ReasonDeniedRepository       = "denied_repository"
+	ReasonTag                    = "tag"
+	ReasonDigestRequired         = "digest_required"
+	ReasonNoPullSecret           = "no_pull_secret"
+	ReasonNoValidPullSecret      = "no_valid_pull_secret"
+	ReasonTrustConfiguration     = "trust_configuration"
+	ReasonSignerSecret           = "signer_secret"
+	ReasonTrustData              = "trust_data"
+	ReasonTrustServerUnavailable = "trust_server_unavailable"
+	ReasonVulnerabilities        = "vulnerabilities"
+	ReasonInternal               = "internal"
+)
+
+var (
+	// Admissions counts admission reviews by decision, namespace and resource kind
+	Admissions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "admissions_total",
+		Help:      "Number of admission reviews by decision, namespace and resource kind.",
+	}, []string{"decision", "namespace", "kind"})
+	// Denials counts the reasons images were denied, an admission that denies several images counts each of them
+	Denials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "denials_total",
+		Help:      "Number of denied images by namespace, resource kind and reason.",
+	}, []string{"namespace", "kind", "reason"})
+	// UnenforcedDenials counts the images that would have been denied by a policy in warn or audit mode
+	UnenforcedDenials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unenforced_denials_total",
+		Help:      "Number of images allowed by policies in warn or audit mode that would otherwise have been denied, by namespace, resource kind, reason and mode.",
+	}, []string{"namespace", "kind", "reason", "mode"})
+	// AdmissionDuration observes the end to end latency of admission reviews by decision
+	AdmissionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "admission_duration_seconds",
+		Help:      "Latency of admission reviews by decision.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"decision"})
+	// DependencyDuration observes the latency of calls to dependencies
+	DependencyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dependency_duration_seconds",
+		Help:      "Latency of calls to dependencies by dependency.",
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"dependency"})
+	// DependencyErrors counts failed calls to dependencies
+	DependencyErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dependency_errors_total",
+		Help:      "Number of failed calls to dependencies by dependency.",
+	}, []string{"dependency"})
+	// CertificateRotations counts the times the serving certificate has been replaced without a restart
+	CertificateRotations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "certificate_rotations_total",
+		Help:      "Number of times the serving certificate has been rotated.",
+	})
+	// CertificateExpiry is the expiry time of the serving certificate
+	CertificateExpiry = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Expiry time of the serving certificate in seconds since the epoch.",
+	})
+	// DigestCacheLookups counts signed digest cache lookups by result, hit or miss
+	DigestCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "digest_cache_lookups_total",
+		Help:      "Number of signed digest cache lookups by result.",
+	}, []string{"result"})
+	// DigestCachePurges counts purges of the signed digest cache
+	DigestCachePurges = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "digest_cache_purges_total",
+		Help:      "Number of times the signed digest cache has been purged.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		Admissions,
+		Denials,
+		UnenforcedDenials,
+		AdmissionDuration,
+		DependencyDuration,
+		DependencyErrors,
+		CertificateRotations,
+		CertificateExpiry,
+		DigestCacheLookups,
+		DigestCachePurges,
+	)
+}
+
+// ObserveDependency records the latency of a call to a dependency that started at start, and counts it if it failed
+func ObserveDependency(dependency string, start time.Time, err error) {
+	DependencyDuration.WithLabelValues(dependency).Observe(time.Since(start).Seconds())
+	if err != nil {
+		DependencyErrors.WithLabelValues(dependency).Inc()
+	}
+}
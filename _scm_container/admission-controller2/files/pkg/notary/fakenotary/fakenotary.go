@@ -66,3 +66,10 @@ func (fake *FakeNotary) GetNotaryRepoReturns(notaryRepo notaryclient.Repository,
 		err        error
 	}{notaryRepo, err})
 }
+
+// GetNotaryRepoCallCount ...
+func (fake *FakeNotary) GetNotaryRepoCallCount() int {
+	fake.getNotaryRepoMutex.RLock()
+	defer fake.getNotaryRepoMutex.RUnlock()
+	return len(fake.GetNotaryRepoArgsForCall)
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	store "github.com/theupdateframework/notary/storage"
+)
+
+var _ store.MetadataStore = &memoryStore{}
+
+// memoryStore is an in memory TUF metadata store for a single repository
+// It is safe for concurrent use, so admissions of images from the same repository can share it
+type memoryStore struct {
+	mutex sync.RWMutex
+	meta  map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{meta: map[string][]byte{}}
+}
+
+// GetSized returns up to size bytes of the metadata, all of it if size is NoSizeLimit
+func (m *memoryStore) GetSized(name string, size int64) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	meta, ok := m.meta[name]
+	if !ok {
+		return nil, store.ErrMetaNotFound{Resource: name}
+	}
+	if size != store.NoSizeLimit && int64(len(meta)) > size {
+		return meta[:size], nil
+	}
+	return meta, nil
+}
+
+// Set stores the metadata
+func (m *memoryStore) Set(name string, blob []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.meta[name] = blob
+	return nil
+}
+
+// SetMulti stores each of the metadata
+func (m *memoryStore) SetMulti(metas map[string][]byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for name, blob := range metas {
+		m.meta[name] = blob
+	}
+	return nil
+}
+
+// RemoveAll removes all of the metadata
+func (m *memoryStore) RemoveAll() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.meta = map[string][]byte{}
+	return nil
+}
+
+// Remove removes the metadata
+func (m *memoryStore) Remove(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.meta, name)
+	return nil
+}
+
+// Location describes where the metadata is stored
+func (m *memoryStore) Location() string {
+	return "memory"
+}
+
+// memoryStores holds the metadata stores of the most recently used repositories
+// When size is 0 nothing is kept and every repository gets a new store, so metadata is fetched for every admission
+type memoryStores struct {
+	mutex sync.Mutex
+	cache *lru.Cache
+}
+
+func newMemoryStores(size int) (*memoryStores, error) {
+	if size == 0 {
+		return &memoryStores{}, nil
+	}
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryStores{cache: cache}, nil
+}
+
+// get returns the metadata store of the repository, creating it if it is not cached
+func (s *memoryStores) get(server, gun string) *memoryStore {
+	if s.cache == nil {
+		return newMemoryStore()
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// The same GUN may be served by different trust servers, which must not share metadata
+	key := server + "|" + gun
+	if value, ok := s.cache.Get(key); ok {
+		return value.(*memoryStore)
+	}
+	metadata := newMemoryStore()
+	s.cache.Add(key, metadata)
+	return metadata
+}
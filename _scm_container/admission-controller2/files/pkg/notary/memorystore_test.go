@@ -0,0 +1,97 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	store "github.com/theupdateframework/notary/storage"
+)
+
+var _ = Describe("Memory store", func() {
+
+	Describe("memoryStore", func() {
+		var metadata *memoryStore
+
+		BeforeEach(func() {
+			metadata = newMemoryStore()
+		})
+
+		It("should return an ErrMetaNotFound for metadata it does not have", func() {
+			_, err := metadata.GetSized("root", store.NoSizeLimit)
+			Expect(err).To(Equal(store.ErrMetaNotFound{Resource: "root"}))
+		})
+
+		It("should return the metadata that was set", func() {
+			Expect(metadata.Set("root", []byte("root.json"))).To(Succeed())
+			Expect(metadata.SetMulti(map[string][]byte{"targets": []byte("targets.json"), "snapshot": []byte("snapshot.json")})).To(Succeed())
+			Expect(metadata.GetSized("root", store.NoSizeLimit)).To(Equal([]byte("root.json")))
+			Expect(metadata.GetSized("targets", store.NoSizeLimit)).To(Equal([]byte("targets.json")))
+			Expect(metadata.GetSized("snapshot", store.NoSizeLimit)).To(Equal([]byte("snapshot.json")))
+		})
+
+		It("should return at most size bytes", func() {
+			Expect(metadata.Set("root", []byte("root.json"))).To(Succeed())
+			Expect(metadata.GetSized("root", 4)).To(Equal([]byte("root")))
+			Expect(metadata.GetSized("root", 100)).To(Equal([]byte("root.json")))
+		})
+
+		It("should remove metadata", func() {
+			Expect(metadata.SetMulti(map[string][]byte{"root": []byte("root.json"), "targets": []byte("targets.json")})).To(Succeed())
+			Expect(metadata.Remove("root")).To(Succeed())
+			_, err := metadata.GetSized("root", store.NoSizeLimit)
+			Expect(err).To(HaveOccurred())
+			Expect(metadata.GetSized("targets", store.NoSizeLimit)).To(Equal([]byte("targets.json")))
+
+			Expect(metadata.RemoveAll()).To(Succeed())
+			_, err = metadata.GetSized("targets", store.NoSizeLimit)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("memoryStores", func() {
+		It("should share the store of a repository", func() {
+			stores, err := newMemoryStores(2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stores.get("https://notary", "docker.io/library/alpine")).To(BeIdenticalTo(stores.get("https://notary", "docker.io/library/alpine")))
+		})
+
+		It("should not share the store of the same GUN on different servers", func() {
+			stores, err := newMemoryStores(2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stores.get("https://notary", "docker.io/library/alpine")).ToNot(BeIdenticalTo(stores.get("https://other", "docker.io/library/alpine")))
+		})
+
+		It("should evict the least recently used repository", func() {
+			stores, err := newMemoryStores(1)
+			Expect(err).ToNot(HaveOccurred())
+			alpine := stores.get("https://notary", "docker.io/library/alpine")
+			stores.get("https://notary", "docker.io/library/busybox")
+			Expect(stores.get("https://notary", "docker.io/library/alpine")).ToNot(BeIdenticalTo(alpine))
+		})
+
+		It("should not share any stores if the size is 0", func() {
+			stores, err := newMemoryStores(0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stores.get("https://notary", "docker.io/library/alpine")).ToNot(BeIdenticalTo(stores.get("https://notary", "docker.io/library/alpine")))
+		})
+
+		It("should return an error if the size is negative", func() {
+			_, err := newMemoryStores(-1)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+})
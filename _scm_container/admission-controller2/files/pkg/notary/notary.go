@@ -24,6 +24,9 @@ import (
 	"time"
 
 	"github.com/docker/distribution/registry/client/transport"
+	"github.com/theupdateframework/notary/client/changelist"
+	"github.com/theupdateframework/notary/cryptoservice"
+	store "github.com/theupdateframework/notary/storage"
 	"github.com/theupdateframework/notary/trustpinning"
 	"github.com/theupdateframework/notary/tuf/data"
 
@@ -32,8 +35,11 @@ import (
 
 // Client .
 type Client struct {
-	trustDir string
-	rootCAs  *x509.CertPool
+	trustDir     string
+	rootCAs      *x509.CertPool
+	trustPinning trustpinning.TrustPinConfig
+	// memoryStores holds the metadata of repositories in memory, metadata is cached in trustDir if it is nil
+	memoryStores *memoryStores
 }
 
 // Interface .
@@ -41,13 +47,37 @@ type Interface interface {
 	GetNotaryRepo(server, image, notaryToken string) (notaryclient.Repository, error)
 }
 
-// NewClient creates and initializes the client
-func NewClient(trustDir string, customCA []byte) (Interface, error) {
+// NewClient creates and initializes a client that caches the metadata of repositories in trustDir
+// The roots of notary repositories are verified against trustPinning, an empty config trusts the first root fetched for a GUN
+func NewClient(trustDir string, customCA []byte, trustPinning trustpinning.TrustPinConfig) (Interface, error) {
 	// Create a trust directory
 	err := createTrustDir(trustDir)
 	if err != nil {
 		return nil, err
 	}
+	rootCA, err := newRootCAs(customCA)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{trustDir: trustDir, rootCAs: rootCA, trustPinning: trustPinning}, nil
+}
+
+// NewMemoryClient creates and initializes a client that caches the metadata of up to size repositories in memory
+// A size of 0 caches nothing, so the metadata is fetched for every admission
+func NewMemoryClient(customCA []byte, trustPinning trustpinning.TrustPinConfig, size int) (Interface, error) {
+	stores, err := newMemoryStores(size)
+	if err != nil {
+		return nil, err
+	}
+	rootCA, err := newRootCAs(customCA)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rootCAs: rootCA, trustPinning: trustPinning, memoryStores: stores}, nil
+}
+
+// newRootCAs returns the system cert pool with the custom CA added to it
+func newRootCAs(customCA []byte) (*x509.CertPool, error) {
 	rootCA, err := x509.SystemCertPool()
 	if err != nil {
 		return nil, err
@@ -55,18 +85,47 @@ func NewClient(trustDir string, customCA []byte) (Interface, error) {
 	if customCA != nil {
 		rootCA.AppendCertsFromPEM(customCA)
 	}
-	return &Client{trustDir: trustDir, rootCAs: rootCA}, nil
+	return rootCA, nil
 }
 
 // GetNotaryRepo .
 func (c Client) GetNotaryRepo(server, image, notaryToken string) (notaryclient.Repository, error) {
+	if c.memoryStores != nil {
+		return c.getMemoryRepo(server, image, notaryToken)
+	}
 	return notaryclient.NewFileCachedRepository(
 		c.trustDir,
 		data.GUN(image),
 		server,
 		c.makeHubTransport(notaryToken),
 		nil,
-		trustpinning.TrustPinConfig{},
+		c.trustPinning,
+	)
+}
+
+// getMemoryRepo returns a read only repository whose metadata is cached in memory
+// It has no keys and an in memory changelist, as the admission controller never publishes to the repository
+func (c Client) getMemoryRepo(server, image, notaryToken string) (notaryclient.Repository, error) {
+	gun := data.GUN(image)
+	remoteStore, err := store.NewHTTPStore(
+		server+"/v2/"+gun.String()+"/_trust/tuf/",
+		"",
+		"json",
+		"key",
+		c.makeHubTransport(notaryToken),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return notaryclient.NewRepository(
+		"",
+		gun,
+		server,
+		remoteStore,
+		c.memoryStores.get(server, gun.String()),
+		c.trustPinning,
+		cryptoservice.NewCryptoService(),
+		changelist.NewMemChangelist(),
 	)
 }
 
@@ -15,8 +15,12 @@
 package notary
 
 import (
+	"io/ioutil"
+	"path/filepath"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/theupdateframework/notary/trustpinning"
 )
 
 var _ = Describe("Notary", func() {
@@ -25,7 +29,7 @@ var _ = Describe("Notary", func() {
 	)
 
 	BeforeEach(func() {
-		trust, _ = NewClient(trustDir, nil)
+		trust, _ = NewClient(trustDir, nil, trustpinning.TrustPinConfig{})
 	})
 
 	Describe("Getting the notary repo", func() {
@@ -36,4 +40,66 @@ var _ = Describe("Notary", func() {
 		})
 	})
 
+	Describe("Getting the notary repo from a memory client", func() {
+		It("should return an error", func() {
+			memoryTrust, err := NewMemoryClient(nil, trustpinning.TrustPinConfig{}, 10)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = memoryTrust.GetNotaryRepo("server", "image", "notaryToken")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("HTTPStore requires an absolute baseURL"))
+		})
+
+		It("should return a repository", func() {
+			memoryTrust, err := NewMemoryClient(nil, trustpinning.TrustPinConfig{}, 10)
+			Expect(err).ToNot(HaveOccurred())
+			repo, err := memoryTrust.GetNotaryRepo("https://notary.docker.io", "docker.io/library/alpine", "notaryToken")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.GetGUN().String()).To(Equal("docker.io/library/alpine"))
+		})
+	})
+
+	Describe("Loading the trust pinning configuration", func() {
+		var writeFile func(name, content string) string
+
+		BeforeEach(func() {
+			writeFile = func(name, content string) string {
+				file := filepath.Join(trustDir, name)
+				Expect(ioutil.WriteFile(file, []byte(content), 0600)).To(Succeed())
+				return file
+			}
+		})
+
+		It("should return the pinned certificates and CAs", func() {
+			caFile := writeFile("ca.pem", "ca")
+			config, err := LoadTrustPinning(writeFile("pinning.json", `{
+				"certs": {"docker.io/library/alpine": ["abc"]},
+				"ca": {"us.icr.io/": "`+caFile+`"},
+				"disableTOFU": true
+			}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config).To(Equal(trustpinning.TrustPinConfig{
+				Certs:       map[string][]string{"docker.io/library/alpine": {"abc"}},
+				CA:          map[string]string{"us.icr.io/": caFile},
+				DisableTOFU: true,
+			}))
+		})
+
+		It("should return an error if the file does not exist", func() {
+			_, err := LoadTrustPinning(filepath.Join(trustDir, "missing.json"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return an error if the file is not JSON", func() {
+			_, err := LoadTrustPinning(writeFile("invalid.json", "certs:"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Failed to unmarshall trust pinning configuration"))
+		})
+
+		It("should return an error if a CA file does not exist", func() {
+			_, err := LoadTrustPinning(writeFile("missingca.json", `{"ca": {"us.icr.io/": "/does/not/exist.pem"}}`))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("CA of the GUN prefix us.icr.io/ is not readable"))
+		})
+	})
+
 })
@@ -0,0 +1,60 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notary
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/theupdateframework/notary/trustpinning"
+)
+
+// TrustPinning is the file format of the trust pinning configuration the roots of notary repositories are verified against
+// Without trust pinning the first root fetched for a GUN is trusted on first use
+type TrustPinning struct {
+	// Certs pins the root of a GUN to the IDs of its root certificates
+	Certs map[string][]string `json:"certs,omitempty"`
+	// CA pins the roots of the GUNs that start with a prefix to the CA bundle in a file
+	CA map[string]string `json:"ca,omitempty"`
+	// DisableTOFU denies the GUNs that are not pinned instead of trusting their first root
+	DisableTOFU bool `json:"disableTOFU,omitempty"`
+}
+
+// LoadTrustPinning reads the trust pinning configuration from the JSON file
+func LoadTrustPinning(file string) (trustpinning.TrustPinConfig, error) {
+	config := trustpinning.TrustPinConfig{}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+
+	pinning := TrustPinning{}
+	if err := json.Unmarshal(content, &pinning); err != nil {
+		return config, fmt.Errorf("Failed to unmarshall trust pinning configuration %s: %v", file, err)
+	}
+	// notary only reads the CA files when a root is validated, check them now so that a typo is not found at admission time
+	for prefix, caFile := range pinning.CA {
+		if _, err := os.Stat(caFile); err != nil {
+			return config, fmt.Errorf("CA of the GUN prefix %s is not readable: %v", prefix, err)
+		}
+	}
+
+	config.Certs = pinning.Certs
+	config.CA = pinning.CA
+	config.DisableTOFU = pinning.DisableTOFU
+	return config, nil
+}
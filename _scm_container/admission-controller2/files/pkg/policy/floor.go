@@ -0,0 +1,121 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
+	"admission-controller2/pkg/va"
+)
+
+// enforcementModeRank orders enforcement modes from the least to the most strict
+var enforcementModeRank = map[string]int{
+	securityenforcementv1beta1.EnforcementModeAudit:   1,
+	securityenforcementv1beta1.EnforcementModeWarn:    2,
+	securityenforcementv1beta1.EnforcementModeEnforce: 3,
+}
+
+// findFloor returns the closest match for the image among the ClusterImagePolicies that are not overridable
+// It ignores the overridable ones, so that a more specific overridable ClusterImagePolicy does not hide a broader floor
+func findFloor(clusterPolicyList *securityenforcementv1beta1.ClusterImagePolicyList, image string) *securityenforcementv1beta1.PolicyMatch {
+	floors := securityenforcementv1beta1.ClusterImagePolicyList{}
+	for _, clusterPolicy := range clusterPolicyList.Items {
+		if !clusterPolicy.Spec.IsOverridable() {
+			floors.Items = append(floors.Items, clusterPolicy)
+		}
+	}
+	return floors.FindClusterImagePolicy(image)
+}
+
+// applyFloor returns the ImagePolicy match with its policy made at least as strict as the ClusterImagePolicy floor
+func applyFloor(floor, match *securityenforcementv1beta1.PolicyMatch) *securityenforcementv1beta1.PolicyMatch {
+	tightened := *match
+	tightened.Policy = tightenPolicy(floor.Policy, match.Policy)
+	tightened.Floor = floor
+	if floor.Deny && !match.Deny {
+		tightened.Deny, tightened.Message = true, floor.Message
+	}
+	return &tightened
+}
+
+// tightenPolicy returns the policy with everything the floor requires added to it
+// Tag constraints are not merged, images are checked against the tag constraints of both policies
+func tightenPolicy(floor, policy securityenforcementv1beta1.Policy) securityenforcementv1beta1.Policy {
+	tightened := *policy.DeepCopy()
+
+	if enabled(floor.Trust.Enabled) {
+		if enabled(policy.Trust.Enabled) {
+			tightened.Trust.SignerSecrets = unionSigners(floor.Trust.SignerSecrets, policy.Trust.SignerSecrets)
+			// Every group must be satisfied, so the groups of both policies are required
+			tightened.Trust.SignerGroups = append(floor.DeepCopy().Trust.SignerGroups, tightened.Trust.SignerGroups...)
+		} else {
+			tightened.Trust.SignerSecrets = append([]securityenforcementv1beta1.Signer(nil), floor.Trust.SignerSecrets...)
+			tightened.Trust.SignerGroups = floor.DeepCopy().Trust.SignerGroups
+		}
+		tightened.Trust.Enabled = securityenforcementv1beta1.TruePointer
+		// Trust data must come from the server the floor uses, otherwise a namespace could point at a server it controls
+		tightened.Trust.TrustServer = floor.Trust.TrustServer
+	}
+
+	if enabled(floor.Va.Enabled) {
+		if enabled(policy.Va.Enabled) {
+			tightened.Va.Threshold = va.StricterThreshold(floor.Va.Threshold, policy.Va.Threshold)
+			tightened.Va.Exemptions = intersection(floor.Va.Exemptions, policy.Va.Exemptions)
+		} else {
+			tightened.Va.Threshold = floor.Va.Threshold
+			tightened.Va.Exemptions = append([]string(nil), floor.Va.Exemptions...)
+		}
+		tightened.Va.Enabled = securityenforcementv1beta1.TruePointer
+	}
+
+	if enforcementModeRank[floor.GetEnforcementMode()] > enforcementModeRank[policy.GetEnforcementMode()] {
+		tightened.EnforcementMode = floor.GetEnforcementMode()
+	}
+	return tightened
+}
+
+func enabled(b *bool) bool {
+	return b != nil && *b
+}
+
+// unionSigners returns the signers of both lists, every signer is required so requiring more is stricter
+func unionSigners(a, b []securityenforcementv1beta1.Signer) []securityenforcementv1beta1.Signer {
+	signers := append([]securityenforcementv1beta1.Signer(nil), a...)
+	seen := map[securityenforcementv1beta1.Signer]bool{}
+	for _, signer := range a {
+		seen[signer] = true
+	}
+	for _, signer := range b {
+		if !seen[signer] {
+			seen[signer] = true
+			signers = append(signers, signer)
+		}
+	}
+	return signers
+}
+
+// intersection returns the exemptions in both lists, a namespace cannot exempt a vulnerability the floor does not
+func intersection(a, b []string) []string {
+	inB := map[string]bool{}
+	for _, s := range b {
+		inB[s] = true
+	}
+	var both []string
+	for _, s := range a {
+		if inB[s] {
+			both = append(both, s)
+		}
+	}
+	return both
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	securityenforcementclientset "admission-controller2/pkg/apis/securityenforcement/client/clientset/versioned"
+	securityenforcementinformers "admission-controller2/pkg/apis/securityenforcement/client/informers/externalversions"
+	securityenforcementlisters "admission-controller2/pkg/apis/securityenforcement/client/listers/securityenforcement/v1beta1"
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/labels"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var _ Interface = &InformerClient{}
+
+// InformerClient is responsible for working out which policy should be enforced
+// It reads the policy CRDs and namespaces from shared informer caches instead of listing them from the API server on every admission
+type InformerClient struct {
+	// informerFactory is the shared informer factory for the policy CRDs
+	informerFactory securityenforcementinformers.SharedInformerFactory
+	// kubeInformerFactory is the shared informer factory for namespaces
+	kubeInformerFactory kubeinformers.SharedInformerFactory
+	// imagePolicyLister lists ImagePolicies from the informer cache
+	imagePolicyLister securityenforcementlisters.ImagePolicyLister
+	// clusterImagePolicyLister lists ClusterImagePolicies from the informer cache
+	clusterImagePolicyLister securityenforcementlisters.ClusterImagePolicyLister
+	// namespaceLister gets namespaces, for their labels, from the informer cache
+	namespaceLister corelisters.NamespaceLister
+	// cacheSyncs reports whether each of the informers has synced
+	cacheSyncs []cache.InformerSynced
+}
+
+// NewInformerClient creates a new policy client backed by informers built from the Security Enforcement and kubernetes client sets it is passed
+// Start must be called before the client is used
+func NewInformerClient(policyClientSet securityenforcementclientset.Interface, kubeClientSet kubernetes.Interface, resync time.Duration) *InformerClient {
+	factory := securityenforcementinformers.NewSharedInformerFactory(policyClientSet, resync)
+	imagePolicies := factory.Securityenforcement().V1beta1().ImagePolicies()
+	clusterImagePolicies := factory.Securityenforcement().V1beta1().ClusterImagePolicies()
+	kubeFactory := kubeinformers.NewSharedInformerFactory(kubeClientSet, resync)
+	namespaces := kubeFactory.Core().V1().Namespaces()
+
+	return &InformerClient{
+		informerFactory:          factory,
+		kubeInformerFactory:      kubeFactory,
+		imagePolicyLister:        imagePolicies.Lister(),
+		clusterImagePolicyLister: clusterImagePolicies.Lister(),
+		namespaceLister:          namespaces.Lister(),
+		cacheSyncs: []cache.InformerSynced{
+			imagePolicies.Informer().HasSynced,
+			clusterImagePolicies.Informer().HasSynced,
+			namespaces.Informer().HasSynced,
+		},
+	}
+}
+
+// Start starts the informers and blocks until their caches have synced
+// The informers keep running until stopCh is closed
+func (c *InformerClient) Start(stopCh <-chan struct{}) error {
+	glog.Info("Starting policy informers...")
+	c.informerFactory.Start(stopCh)
+	c.kubeInformerFactory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, c.cacheSyncs...) {
+		return fmt.Errorf("failed to wait for policy caches to sync")
+	}
+	glog.Info("Policy informer caches synced")
+	return nil
+}
+
+// HasSynced returns true once all of the informer caches have synced
+func (c *InformerClient) HasSynced() bool {
+	for _, synced := range c.cacheSyncs {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// getImagePolicyList retrieves the list of image policies in the specified namespace from the informer cache
+func (c *InformerClient) getImagePolicyList(namespace string) (*securityenforcementv1beta1.ImagePolicyList, error) {
+	policies, err := c.imagePolicyLister.ImagePolicies(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	// The cache has no ordering, sort by name so matching is deterministic
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+
+	policyList := &securityenforcementv1beta1.ImagePolicyList{}
+	for _, policy := range policies {
+		policyList.Items = append(policyList.Items, *policy)
+	}
+	return policyList, nil
+}
+
+// getClusterImagePolicyList retrieves the list of clusterwide image policies from the informer cache
+func (c *InformerClient) getClusterImagePolicyList() (*securityenforcementv1beta1.ClusterImagePolicyList, error) {
+	policies, err := c.clusterImagePolicyLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	// The cache has no ordering, sort by name so matching is deterministic
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+
+	policyList := &securityenforcementv1beta1.ClusterImagePolicyList{}
+	for _, policy := range policies {
+		policyList.Items = append(policyList.Items, *policy)
+	}
+	return policyList, nil
+}
+
+// getNamespaceLabels retrieves the labels of the specified namespace from the informer cache
+func (c *InformerClient) getNamespaceLabels(namespace string) (map[string]string, error) {
+	ns, err := c.namespaceLister.Get(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return ns.Labels, nil
+}
+
+// GetPolicyToEnforce retrieves the policy that should be enforced for the specified image in the given namespace
+func (c *InformerClient) GetPolicyToEnforce(namespace, image string, objectLabels map[string]string) (*securityenforcementv1beta1.PolicyMatch, error) {
+	policyList, err := c.getImagePolicyList(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return findPolicyToEnforce(namespace, image, objectLabels, policyList, c.getClusterImagePolicyList, c.getNamespaceLabels)
+}
@@ -20,23 +20,30 @@ import (
 	securityenforcementclientset "admission-controller2/pkg/apis/securityenforcement/client/clientset/versioned"
 	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 // Interface defines the interface needed to work out which policy should be enforced
+// The policy is returned with the policy resource and repository that it came from
+// objectLabels are the labels of the object being admitted, they are matched against the objectSelector of ClusterImagePolicies
 type Interface interface {
-	GetPolicyToEnforce(namespace, image string) (*securityenforcementv1beta1.Policy, error)
+	GetPolicyToEnforce(namespace, image string, objectLabels map[string]string) (*securityenforcementv1beta1.PolicyMatch, error)
 }
 
 // Client is responsible for working out which policy should be enforced
 type Client struct {
 	// policyClientSet is a securityenforcementclientset for the policy CRDs
 	policyClientSet securityenforcementclientset.Interface
+	// kubeClientSet is a standard kubernetes clientset for retrieving namespace labels
+	kubeClientSet kubernetes.Interface
 }
 
 // NewClient creates a new policy client using the Security Enforcement client set it is passed
-func NewClient(policyClientSet securityenforcementclientset.Interface) *Client {
+// The kubernetes client set is used to retrieve the labels of namespaces for the namespaceSelector of ClusterImagePolicies
+func NewClient(policyClientSet securityenforcementclientset.Interface, kubeClientSet kubernetes.Interface) *Client {
 	return &Client{
 		policyClientSet: policyClientSet,
+		kubeClientSet:   kubeClientSet,
 	}
 }
 
@@ -58,41 +65,68 @@ func (c *Client) getClusterImagePolicyList() (*securityenforcementv1beta1.Cluste
 	return policies, nil
 }
 
+// getNamespaceLabels retrieves the labels of the specified namespace
+func (c *Client) getNamespaceLabels(namespace string) (map[string]string, error) {
+	ns, err := c.kubeClientSet.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return ns.Labels, nil
+}
+
 // GetPolicyToEnforce retrieves the policy that should be enforced for the specified image in the given namespace
-func (c *Client) GetPolicyToEnforce(namespace, image string) (*securityenforcementv1beta1.Policy, error) {
+func (c *Client) GetPolicyToEnforce(namespace, image string, objectLabels map[string]string) (*securityenforcementv1beta1.PolicyMatch, error) {
 	policyList, err := c.getImagePolicyList(namespace)
 	if err != nil {
 		return nil, err
 	}
+	return findPolicyToEnforce(namespace, image, objectLabels, policyList, c.getClusterImagePolicyList, c.getNamespaceLabels)
+}
 
-	if len((*policyList).Items) == 0 {
-		// We don't have any image policies in the current namespace, get the list of cluster policies
-		clusterPolicyList, err := c.getClusterImagePolicyList()
-		if err != nil {
-			return nil, err
-		}
+// findPolicyToEnforce works out which policy should be enforced for the image from the namespace's image policies and the cluster image policies
+// Cluster image policies whose namespace or object selectors do not match are ignored. A namespace with image policies uses them instead of the cluster image policies, but the closest matching cluster image policy that is not
+// overridable is a floor that the namespace's policy is made at least as strict as
+func findPolicyToEnforce(namespace, image string, objectLabels map[string]string, policyList *securityenforcementv1beta1.ImagePolicyList, getClusterImagePolicyList func() (*securityenforcementv1beta1.ClusterImagePolicyList, error), getNamespaceLabels func(namespace string) (map[string]string, error)) (*securityenforcementv1beta1.PolicyMatch, error) {
+	clusterPolicyList, err := getClusterImagePolicyList()
+	if err != nil {
+		return nil, err
+	}
+	selectedClusterPolicyList, err := selectClusterImagePolicies(clusterPolicyList, namespace, objectLabels, getNamespaceLabels)
+	if err != nil {
+		return nil, err
+	}
+	clusterPolicy := selectedClusterPolicyList.FindClusterImagePolicy(image)
 
+	if len((*policyList).Items) == 0 {
+		// We don't have any image policies in the current namespace, use the cluster policies
 		if len((*clusterPolicyList).Items) == 0 {
 			// We also don't have any cluster image policies, deny the request
 			return nil, fmt.Errorf("Deny %q, no image policies or cluster polices", image)
 		}
 
-		// See if there is a match for the image
-		clusterPolicy := clusterPolicyList.FindClusterImagePolicy(image)
 		if clusterPolicy == nil {
 			// We also don't have any cluster image policies, deny the request
 			return nil, fmt.Errorf("Deny %q, no matching repositories in ClusterImagePolicy and no ImagePolicies in the %q namespace", image, namespace)
 		}
+		if clusterPolicy.Overridable {
+			// A closer overridable ClusterImagePolicy must still be as strict as the floor
+			if floor := findFloor(selectedClusterPolicyList, image); floor != nil {
+				return applyFloor(floor, clusterPolicy), nil
+			}
+		}
 		return clusterPolicy, nil
 	}
 
 	// For this image, see if there is an ImagePolicy repository that matches.
 	// Get the policy if it does
 	policy := policyList.FindImagePolicy(image)
-
 	if policy == nil {
-		// We also don't have any cluster image policies, deny the request
+		// The namespace's policies deny images they don't match, a floor can only make them stricter
 		return nil, fmt.Errorf("Deny %q, no matching repositories in the ImagePolicies", image)
 	}
+
+	if floor := findFloor(selectedClusterPolicyList, image); floor != nil {
+		return applyFloor(floor, policy), nil
+	}
 	return policy, nil
 }
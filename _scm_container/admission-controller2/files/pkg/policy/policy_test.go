@@ -22,8 +22,10 @@ import (
 	"admission-controller2/pkg/apis/securityenforcement/client/clientset/versioned/fake"
 	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 )
 
 var (
@@ -66,6 +68,8 @@ var (
 
 	enabledTrustPolicy  = securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool}}
 	disabledTrustPolicy = securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &falseBool}}
+
+	prodSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
 )
 
 func createClusterImagePolicy(name string, repos []securityenforcementv1beta1.Repository) *securityenforcementv1beta1.ClusterImagePolicy {
@@ -78,6 +82,23 @@ func createClusterImagePolicy(name string, repos []securityenforcementv1beta1.Re
 	}
 }
 
+func createFloorClusterImagePolicy(name string, repos []securityenforcementv1beta1.Repository) *securityenforcementv1beta1.ClusterImagePolicy {
+	policy := createClusterImagePolicy(name, repos)
+	policy.Spec.Overridable = &falseBool
+	return policy
+}
+
+func createSelectedClusterImagePolicy(name string, namespaceSelector, objectSelector *metav1.LabelSelector, repos []securityenforcementv1beta1.Repository) *securityenforcementv1beta1.ClusterImagePolicy {
+	policy := createClusterImagePolicy(name, repos)
+	policy.Spec.NamespaceSelector = namespaceSelector
+	policy.Spec.ObjectSelector = objectSelector
+	return policy
+}
+
+func createNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
 func createImagePolicy(name, namespace string, repos []securityenforcementv1beta1.Repository) *securityenforcementv1beta1.ImagePolicy {
 	return &securityenforcementv1beta1.ImagePolicy{
 		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
@@ -88,20 +109,33 @@ func createImagePolicy(name, namespace string, repos []securityenforcementv1beta
 	}
 }
 
-func setup(policies []runtime.Object) (*Client, securityenforcementclientset.Interface) {
+func setup(policies []runtime.Object, kubeObjects ...runtime.Object) (*Client, securityenforcementclientset.Interface) {
 	clientSet := fake.NewSimpleClientset(policies...)
-	return NewClient(clientSet), clientSet
+	return NewClient(clientSet, k8sfake.NewSimpleClientset(kubeObjects...)), clientSet
+}
+
+func setupInformer(t *testing.T, policies []runtime.Object, kubeObjects ...runtime.Object) (*InformerClient, chan struct{}) {
+	stopCh := make(chan struct{})
+	client := NewInformerClient(fake.NewSimpleClientset(policies...), k8sfake.NewSimpleClientset(kubeObjects...), 0)
+	if err := client.Start(stopCh); err != nil {
+		t.Fatal(err)
+	}
+	return client, stopCh
 }
 
 func TestClient_GetPolicyToEnforce(t *testing.T) {
 
 	tests := []struct {
-		name      string
-		namespace string
-		image     string
-		policies  []runtime.Object
-		want      *securityenforcementv1beta1.Policy
-		wantErr   error
+		name         string
+		namespace    string
+		image        string
+		objectLabels map[string]string
+		policies     []runtime.Object
+		namespaces   []runtime.Object
+		want         *securityenforcementv1beta1.Policy
+		wantMatch    string
+		wantDeny     bool
+		wantErr      error
 	}{
 		{
 			name:      "No Image policy, but relevant cluster policy: return cluster policy",
@@ -109,6 +143,18 @@ func TestClient_GetPolicyToEnforce(t *testing.T) {
 			namespace: "default",
 			policies:  []runtime.Object{createClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled})},
 			want:      &enabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy policy-one repository "registry.bluemix.net/hello/world"`,
+		},
+		{
+			name:      "No Image policy, but wildcard cluster policy: return cluster policy",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{createClusterImagePolicy("default", []securityenforcementv1beta1.Repository{
+				{Name: "*", Policy: disabledTrustPolicy},
+				{Name: "registry.bluemix.net/*", Policy: enabledTrustPolicy},
+			})},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy default repository "registry.bluemix.net/*"`,
 		},
 		{
 			name:      "No Image policy, cluster policy has no repo match: return error",
@@ -150,7 +196,8 @@ func TestClient_GetPolicyToEnforce(t *testing.T) {
 				createClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustDisabled}),
 				createImagePolicy("policy-two", "default", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
 			},
-			want: &enabledTrustPolicy,
+			want:      &enabledTrustPolicy,
+			wantMatch: `ImagePolicy default/policy-two repository "registry.bluemix.net/hello/world"`,
 		},
 		{
 			name:      "Relevant Image policies in different namspaces: return correct image policy",
@@ -181,6 +228,183 @@ func TestClient_GetPolicyToEnforce(t *testing.T) {
 			},
 			wantErr: errors.New(`Deny "registry.bluemix.net/hello/world", no matching repositories in the ImagePolicies`),
 		},
+		{
+			name:      "Image policy and floor cluster policy: return image policy tightened by the cluster policy",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createFloorClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+				createImagePolicy("policy-two", "default", []securityenforcementv1beta1.Repository{{Name: "*", Policy: disabledTrustPolicy}}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ImagePolicy default/policy-two repository "*" with floor ClusterImagePolicy policy-one repository "registry.bluemix.net/hello/world"`,
+		},
+		{
+			name:      "Image policy stricter than floor cluster policy: return image policy",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createFloorClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustDisabled}),
+				createImagePolicy("policy-two", "default", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ImagePolicy default/policy-two repository "registry.bluemix.net/hello/world" with floor ClusterImagePolicy policy-one repository "registry.bluemix.net/hello/world"`,
+		},
+		{
+			name:      "Image policies without relevant repository but matching floor cluster policy: return error",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createImagePolicy("policy-one", "default", []securityenforcementv1beta1.Repository{helloEarthRepositoryTrustDisabled}),
+				createFloorClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			wantErr: errors.New(`Deny "registry.bluemix.net/hello/world", no matching repositories in the ImagePolicies`),
+		},
+		{
+			name:      "Image policy, overridable cluster policy and broader floor cluster policy: return image policy tightened by the floor",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustDisabled}),
+				createFloorClusterImagePolicy("policy-two", []securityenforcementv1beta1.Repository{{Name: "registry.bluemix.net/*", Policy: enabledTrustPolicy}}),
+				createImagePolicy("policy-three", "default", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustDisabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ImagePolicy default/policy-three repository "registry.bluemix.net/hello/world" with floor ClusterImagePolicy policy-two repository "registry.bluemix.net/*"`,
+		},
+		{
+			name:      "Image policy and floor cluster policy for another repository: return image policy",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createFloorClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{helloEarthRepositoryTrustEnabled}),
+				createImagePolicy("policy-two", "default", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustDisabled}),
+			},
+			want:      &disabledTrustPolicy,
+			wantMatch: `ImagePolicy default/policy-two repository "registry.bluemix.net/hello/world"`,
+		},
+		{
+			name:      "Image policy and denying floor cluster policy: return denied image policy",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createFloorClusterImagePolicy("policy-one", []securityenforcementv1beta1.Repository{{Name: "registry.bluemix.net/*", Deny: true, Message: "use the internal mirror"}}),
+				createImagePolicy("policy-two", "default", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ImagePolicy default/policy-two repository "registry.bluemix.net/hello/world" with floor ClusterImagePolicy policy-one repository "registry.bluemix.net/*"`,
+			wantDeny:  true,
+		},
+		{
+			name:      "Image policy denies the image: return denied image policy",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createImagePolicy("policy-one", "default", []securityenforcementv1beta1.Repository{
+					{Name: "*", Policy: enabledTrustPolicy},
+					{Name: "registry.bluemix.net/*", Deny: true},
+				}),
+			},
+			want:      &securityenforcementv1beta1.Policy{},
+			wantMatch: `ImagePolicy default/policy-one repository "registry.bluemix.net/*"`,
+			wantDeny:  true,
+		},
+		{
+			name:       "No Image policy, cluster policy selects the namespace: return cluster policy",
+			image:      "registry.bluemix.net/hello/world",
+			namespace:  "default",
+			namespaces: []runtime.Object{createNamespace("default", map[string]string{"env": "prod"})},
+			policies: []runtime.Object{
+				createSelectedClusterImagePolicy("policy-one", prodSelector, nil, []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy policy-one repository "registry.bluemix.net/hello/world"`,
+		},
+		{
+			name:       "No Image policy, cluster policy does not select the namespace: return error",
+			image:      "registry.bluemix.net/hello/world",
+			namespace:  "default",
+			namespaces: []runtime.Object{createNamespace("default", map[string]string{"env": "dev"})},
+			policies: []runtime.Object{
+				createSelectedClusterImagePolicy("policy-one", prodSelector, nil, []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			wantErr: errors.New(`Deny "registry.bluemix.net/hello/world", no matching repositories in ClusterImagePolicy and no ImagePolicies in the "default" namespace`),
+		},
+		{
+			name:       "No Image policy, namespace selected cluster policy is closer than the general cluster policy: return selected cluster policy",
+			image:      "registry.bluemix.net/hello/world",
+			namespace:  "default",
+			namespaces: []runtime.Object{createNamespace("default", map[string]string{"env": "prod"})},
+			policies: []runtime.Object{
+				createClusterImagePolicy("default", []securityenforcementv1beta1.Repository{{Name: "*", Policy: disabledTrustPolicy}}),
+				createSelectedClusterImagePolicy("prod", prodSelector, nil, []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy prod repository "registry.bluemix.net/hello/world"`,
+		},
+		{
+			name:       "No Image policy, namespace not selected: return general cluster policy",
+			image:      "registry.bluemix.net/hello/world",
+			namespace:  "default",
+			namespaces: []runtime.Object{createNamespace("default", nil)},
+			policies: []runtime.Object{
+				createClusterImagePolicy("default", []securityenforcementv1beta1.Repository{{Name: "*", Policy: disabledTrustPolicy}}),
+				createSelectedClusterImagePolicy("prod", prodSelector, nil, []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			want:      &disabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy default repository "*"`,
+		},
+		{
+			name:         "No Image policy, cluster policy selects the object: return cluster policy",
+			image:        "registry.bluemix.net/hello/world",
+			namespace:    "default",
+			objectLabels: map[string]string{"env": "prod", "app": "hello"},
+			policies: []runtime.Object{
+				createClusterImagePolicy("default", []securityenforcementv1beta1.Repository{{Name: "*", Policy: disabledTrustPolicy}}),
+				createSelectedClusterImagePolicy("prod", nil, prodSelector, []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy prod repository "registry.bluemix.net/hello/world"`,
+		},
+		{
+			name:         "No Image policy, cluster policy does not select the object: return general cluster policy",
+			image:        "registry.bluemix.net/hello/world",
+			namespace:    "default",
+			objectLabels: map[string]string{"app": "hello"},
+			policies: []runtime.Object{
+				createClusterImagePolicy("default", []securityenforcementv1beta1.Repository{{Name: "*", Policy: disabledTrustPolicy}}),
+				createSelectedClusterImagePolicy("prod", nil, prodSelector, []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled}),
+			},
+			want:      &disabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy default repository "*"`,
+		},
+		{
+			name:      "No Image policy, overridable cluster policy is closer than a floor cluster policy: return tightened cluster policy",
+			image:     "registry.bluemix.net/hello/world",
+			namespace: "default",
+			policies: []runtime.Object{
+				createFloorClusterImagePolicy("floor", []securityenforcementv1beta1.Repository{{Name: "*", Policy: enabledTrustPolicy}}),
+				createClusterImagePolicy("relaxed", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustDisabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ClusterImagePolicy relaxed repository "registry.bluemix.net/hello/world" with floor ClusterImagePolicy floor repository "*"`,
+		},
+		{
+			name:       "Image policy and floor cluster policy that selects the namespace: return tightened image policy",
+			image:      "registry.bluemix.net/hello/world",
+			namespace:  "default",
+			namespaces: []runtime.Object{createNamespace("default", map[string]string{"env": "prod"})},
+			policies: []runtime.Object{
+				func() runtime.Object {
+					policy := createSelectedClusterImagePolicy("prod", prodSelector, nil, []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustEnabled})
+					policy.Spec.Overridable = &falseBool
+					return policy
+				}(),
+				createImagePolicy("policy-two", "default", []securityenforcementv1beta1.Repository{helloWorldRepositoryTrustDisabled}),
+			},
+			want:      &enabledTrustPolicy,
+			wantMatch: `ImagePolicy default/policy-two repository "registry.bluemix.net/hello/world" with floor ClusterImagePolicy prod repository "registry.bluemix.net/hello/world"`,
+		},
 		{
 			name:      "Multiple Image policies in the same namespace: return relevant image policy",
 			image:     "registry.bluemix.net/hello/world",
@@ -203,19 +427,156 @@ func TestClient_GetPolicyToEnforce(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			client, _ := setup(tt.policies)
-			got, err := client.GetPolicyToEnforce(tt.namespace, tt.image)
-			if tt.wantErr != nil {
-				assert.EqualError(t, err, tt.wantErr.Error())
-				assert.Nil(t, got)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.want, got)
+			client, _ := setup(tt.policies, tt.namespaces...)
+			informerClient, stopCh := setupInformer(t, tt.policies, tt.namespaces...)
+			defer close(stopCh)
+			for _, c := range []Interface{client, informerClient} {
+				got, err := c.GetPolicyToEnforce(tt.namespace, tt.image, tt.objectLabels)
+				if tt.wantErr != nil {
+					assert.EqualError(t, err, tt.wantErr.Error())
+					assert.Nil(t, got)
+				} else {
+					assert.NoError(t, err)
+					if assert.NotNil(t, got) {
+						assert.Equal(t, tt.want, &got.Policy)
+					}
+					if tt.wantMatch != "" {
+						assert.Equal(t, tt.wantMatch, got.String())
+					}
+					assert.Equal(t, tt.wantDeny, got.Deny)
+				}
 			}
 		})
 	}
 }
 
+func TestSelectClusterImagePolicies(t *testing.T) {
+	invalidSelector := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Near"}}}
+	policyList := &securityenforcementv1beta1.ClusterImagePolicyList{Items: []securityenforcementv1beta1.ClusterImagePolicy{
+		*createClusterImagePolicy("default", nil),
+		*createSelectedClusterImagePolicy("prod-namespaces", prodSelector, nil, nil),
+		*createSelectedClusterImagePolicy("prod-objects", nil, prodSelector, nil),
+	}}
+	names := func(policyList *securityenforcementv1beta1.ClusterImagePolicyList) []string {
+		names := []string{}
+		for _, policy := range policyList.Items {
+			names = append(names, policy.Name)
+		}
+		return names
+	}
+	namespaceLookups := 0
+	getNamespaceLabels := func(namespaceLabels map[string]string, err error) func(string) (map[string]string, error) {
+		return func(string) (map[string]string, error) {
+			namespaceLookups++
+			return namespaceLabels, err
+		}
+	}
+
+	t.Run("Selects policies matching the namespace and object labels", func(t *testing.T) {
+		namespaceLookups = 0
+		selected, err := selectClusterImagePolicies(policyList, "default", map[string]string{"env": "prod"}, getNamespaceLabels(map[string]string{"env": "prod"}, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"default", "prod-namespaces", "prod-objects"}, names(selected))
+		assert.Equal(t, 1, namespaceLookups)
+	})
+	t.Run("Ignores policies that do not match", func(t *testing.T) {
+		selected, err := selectClusterImagePolicies(policyList, "default", nil, getNamespaceLabels(nil, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"default"}, names(selected))
+	})
+	t.Run("Does not look up the namespace without a namespace selector", func(t *testing.T) {
+		namespaceLookups = 0
+		list := &securityenforcementv1beta1.ClusterImagePolicyList{Items: policyList.Items[:1]}
+		_, err := selectClusterImagePolicies(list, "default", nil, getNamespaceLabels(nil, errors.New("not found")))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, namespaceLookups)
+	})
+	t.Run("Returns an error if the namespace cannot be retrieved", func(t *testing.T) {
+		_, err := selectClusterImagePolicies(policyList, "default", nil, getNamespaceLabels(nil, errors.New("not found")))
+		assert.EqualError(t, err, `Unable to retrieve the labels of namespace "default": not found`)
+	})
+	t.Run("Returns an error for an invalid selector", func(t *testing.T) {
+		list := &securityenforcementv1beta1.ClusterImagePolicyList{Items: []securityenforcementv1beta1.ClusterImagePolicy{
+			*createSelectedClusterImagePolicy("invalid", nil, invalidSelector, nil),
+		}}
+		_, err := selectClusterImagePolicies(list, "default", nil, getNamespaceLabels(nil, nil))
+		assert.Error(t, err)
+	})
+}
+
+func TestTightenPolicy(t *testing.T) {
+	signer := func(name string) securityenforcementv1beta1.Signer {
+		return securityenforcementv1beta1.Signer{Name: name}
+	}
+	tests := []struct {
+		name   string
+		floor  securityenforcementv1beta1.Policy
+		policy securityenforcementv1beta1.Policy
+		want   securityenforcementv1beta1.Policy
+	}{
+		{
+			name:   "Permissive floor leaves the policy unchanged",
+			floor:  securityenforcementv1beta1.Policy{},
+			policy: securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerSecrets: []securityenforcementv1beta1.Signer{signer("a")}}},
+			want:   securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerSecrets: []securityenforcementv1beta1.Signer{signer("a")}}},
+		},
+		{
+			name:   "Floor trust is required with the floor's trust server and signers",
+			floor:  securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, TrustServer: "https://notary.example.com", SignerSecrets: []securityenforcementv1beta1.Signer{signer("a")}}},
+			policy: securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &falseBool, TrustServer: "https://other.example.com", SignerSecrets: []securityenforcementv1beta1.Signer{signer("b")}}},
+			want:   securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, TrustServer: "https://notary.example.com", SignerSecrets: []securityenforcementv1beta1.Signer{signer("a")}}},
+		},
+		{
+			name:   "Signers required by either policy are required",
+			floor:  securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerSecrets: []securityenforcementv1beta1.Signer{signer("a"), signer("b")}}},
+			policy: securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerSecrets: []securityenforcementv1beta1.Signer{signer("b"), signer("c")}}},
+			want:   securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerSecrets: []securityenforcementv1beta1.Signer{signer("a"), signer("b"), signer("c")}}},
+		},
+		{
+			name: "Signer groups of both policies are required",
+			floor: securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerGroups: []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{signer("a"), signer("b")}, Threshold: 1},
+			}}},
+			policy: securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerGroups: []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{signer("c"), signer("d")}, Threshold: 2},
+			}}},
+			want: securityenforcementv1beta1.Policy{Trust: securityenforcementv1beta1.Trust{Enabled: &trueBool, SignerGroups: []securityenforcementv1beta1.SignerGroup{
+				{SignerSecrets: []securityenforcementv1beta1.Signer{signer("a"), signer("b")}, Threshold: 1},
+				{SignerSecrets: []securityenforcementv1beta1.Signer{signer("c"), signer("d")}, Threshold: 2},
+			}}},
+		},
+		{
+			name:   "Floor VA is required with the floor's threshold and exemptions",
+			floor:  securityenforcementv1beta1.Policy{Va: securityenforcementv1beta1.VA{Enabled: &trueBool, Threshold: "medium", Exemptions: []string{"CVE-1"}}},
+			policy: securityenforcementv1beta1.Policy{Va: securityenforcementv1beta1.VA{Threshold: "low", Exemptions: []string{"CVE-2"}}},
+			want:   securityenforcementv1beta1.Policy{Va: securityenforcementv1beta1.VA{Enabled: &trueBool, Threshold: "medium", Exemptions: []string{"CVE-1"}}},
+		},
+		{
+			name:   "Stricter threshold and only common exemptions are kept",
+			floor:  securityenforcementv1beta1.Policy{Va: securityenforcementv1beta1.VA{Enabled: &trueBool, Threshold: "medium", Exemptions: []string{"CVE-1", "CVE-2"}}},
+			policy: securityenforcementv1beta1.Policy{Va: securityenforcementv1beta1.VA{Enabled: &trueBool, Threshold: "critical", Exemptions: []string{"CVE-2", "CVE-3"}}},
+			want:   securityenforcementv1beta1.Policy{Va: securityenforcementv1beta1.VA{Enabled: &trueBool, Threshold: "medium", Exemptions: []string{"CVE-2"}}},
+		},
+		{
+			name:   "Stricter enforcement mode is kept",
+			floor:  securityenforcementv1beta1.Policy{EnforcementMode: securityenforcementv1beta1.EnforcementModeWarn},
+			policy: securityenforcementv1beta1.Policy{EnforcementMode: securityenforcementv1beta1.EnforcementModeAudit},
+			want:   securityenforcementv1beta1.Policy{EnforcementMode: securityenforcementv1beta1.EnforcementModeWarn},
+		},
+		{
+			name:   "Policy cannot relax the floor's enforcement mode",
+			floor:  securityenforcementv1beta1.Policy{},
+			policy: securityenforcementv1beta1.Policy{EnforcementMode: securityenforcementv1beta1.EnforcementModeAudit},
+			want:   securityenforcementv1beta1.Policy{EnforcementMode: securityenforcementv1beta1.EnforcementModeEnforce},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tightenPolicy(tt.floor, tt.policy))
+		})
+	}
+}
+
 func TestClient_getImagePolicyList(t *testing.T) {
 	tests := []struct {
 		name      string
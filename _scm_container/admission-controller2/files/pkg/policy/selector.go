@@ -0,0 +1,70 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+
+	securityenforcementv1beta1 "admission-controller2/pkg/apis/securityenforcement/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// selectClusterImagePolicies returns the cluster image policies whose namespace and object selectors match
+// The namespace's labels are only retrieved if one of the policies has a namespace selector
+func selectClusterImagePolicies(policyList *securityenforcementv1beta1.ClusterImagePolicyList, namespace string, objectLabels map[string]string, getNamespaceLabels func(namespace string) (map[string]string, error)) (*securityenforcementv1beta1.ClusterImagePolicyList, error) {
+	var namespaceLabels map[string]string
+	namespaceLabelsRetrieved := false
+
+	selected := &securityenforcementv1beta1.ClusterImagePolicyList{}
+	for _, policy := range policyList.Items {
+		matches, err := selectorMatches(policy.Spec.ObjectSelector, objectLabels)
+		if err != nil {
+			return nil, fmt.Errorf("ClusterImagePolicy %s has an invalid objectSelector: %v", policy.Name, err)
+		}
+		if !matches {
+			continue
+		}
+
+		if policy.Spec.NamespaceSelector != nil && !namespaceLabelsRetrieved {
+			if namespaceLabels, err = getNamespaceLabels(namespace); err != nil {
+				return nil, fmt.Errorf("Unable to retrieve the labels of namespace %q: %v", namespace, err)
+			}
+			namespaceLabelsRetrieved = true
+		}
+		matches, err = selectorMatches(policy.Spec.NamespaceSelector, namespaceLabels)
+		if err != nil {
+			return nil, fmt.Errorf("ClusterImagePolicy %s has an invalid namespaceSelector: %v", policy.Name, err)
+		}
+		if !matches {
+			continue
+		}
+
+		selected.Items = append(selected.Items, policy)
+	}
+	return selected, nil
+}
+
+// selectorMatches returns true if the label selector matches the labels, a nil selector matches everything
+func selectorMatches(labelSelector *metav1.LabelSelector, set map[string]string) (bool, error) {
+	if labelSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(set)), nil
+}
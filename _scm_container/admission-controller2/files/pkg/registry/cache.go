@@ -0,0 +1,122 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"admission-controller2/helpers/oauth"
+)
+
+const (
+	// defaultTokenLifetime is used when the token server does not say when the token expires
+	// the Docker Registry v2 token specification defaults expires_in to 60 seconds
+	defaultTokenLifetime = 60 * time.Second
+	// tokenExpiryMargin is subtracted from the token lifetime so a token does not expire while it is being used
+	tokenExpiryMargin = 10 * time.Second
+)
+
+// tokenKey identifies a token by the server it was issued for, the repository it grants access to and the credential used to get it
+type tokenKey struct {
+	hostname   string
+	notaryURL  string
+	imageRepo  string
+	username   string
+	credential string
+}
+
+// newTokenKey creates a tokenKey, only a hash of the password is kept
+func newTokenKey(username, password, imageRepo, hostname, notaryURL string) tokenKey {
+	hash := sha256.Sum256([]byte(password))
+	return tokenKey{
+		hostname:   hostname,
+		notaryURL:  notaryURL,
+		imageRepo:  imageRepo,
+		username:   username,
+		credential: hex.EncodeToString(hash[:]),
+	}
+}
+
+type cachedToken struct {
+	token   string
+	expires time.Time
+}
+
+// tokenCache is a concurrency safe cache of content trust tokens
+type tokenCache struct {
+	mutex  sync.Mutex
+	tokens map[tokenKey]cachedToken
+	// now returns the current time, it is replaced in tests
+	now func() time.Time
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens: map[tokenKey]cachedToken{},
+		now:    time.Now,
+	}
+}
+
+// get returns the token for the key if it has not expired
+func (c *tokenCache) get(key tokenKey) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.tokens[key]
+	if !ok {
+		return "", false
+	}
+	if !c.now().Before(cached.expires) {
+		delete(c.tokens, key)
+		return "", false
+	}
+	return cached.token, true
+}
+
+// set caches the token until shortly before it expires, tokens that expire within the margin are not cached
+func (c *tokenCache) set(key tokenKey, token *oauth.TokenResponse) {
+	now := c.now()
+	issuedAt := token.IssuedAt
+	if issuedAt.IsZero() || issuedAt.After(now) {
+		issuedAt = now
+	}
+	lifetime := defaultTokenLifetime
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+	expires := issuedAt.Add(lifetime - tokenExpiryMargin)
+	if !now.Before(expires) {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// Remove expired tokens so credentials that are no longer used do not accumulate
+	for k, cached := range c.tokens {
+		if !now.Before(cached.expires) {
+			delete(c.tokens, k)
+		}
+	}
+	c.tokens[key] = cachedToken{token: token.Token, expires: expires}
+}
+
+// evict removes the token for the key
+func (c *tokenCache) evict(key tokenKey) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.tokens, key)
+}
@@ -24,32 +24,56 @@ var _ registry.Interface = &FakeRegistry{}
 
 // FakeRegistry .
 type FakeRegistry struct {
-	GetContentTrustTokenStub        func(username, password, imageRepo, hostname string) (string, error)
+	GetContentTrustTokenStub        func(username, password, imageRepo, hostname, notaryURL string) (string, error)
 	getContentTrustTokenMutex       sync.RWMutex
 	getContentTrustTokenArgsForCall []struct {
 		username  string
 		password  string
 		imageRepo string
 		hostname  string
+		notaryURL string
 	}
 	getContentTrustTokenReturns struct {
 		token string
 		err   error
 	}
+	InvalidateContentTrustTokenStub        func(username, password, imageRepo, hostname, notaryURL string)
+	invalidateContentTrustTokenMutex       sync.RWMutex
+	invalidateContentTrustTokenArgsForCall []struct {
+		username  string
+		password  string
+		imageRepo string
+		hostname  string
+		notaryURL string
+	}
+	GetDigestStub        func(username, password, repository, tag, registryURL string) (string, error)
+	getDigestMutex       sync.RWMutex
+	getDigestArgsForCall []struct {
+		username    string
+		password    string
+		repository  string
+		tag         string
+		registryURL string
+	}
+	getDigestReturns struct {
+		digest string
+		err    error
+	}
 }
 
 // GetContentTrustToken ...
-func (fake *FakeRegistry) GetContentTrustToken(username, password, imageRepo, hostname string) (string, error) {
+func (fake *FakeRegistry) GetContentTrustToken(username, password, imageRepo, hostname, notaryURL string) (string, error) {
 	fake.getContentTrustTokenMutex.Lock()
 	fake.getContentTrustTokenArgsForCall = append(fake.getContentTrustTokenArgsForCall, struct {
 		username  string
 		password  string
 		imageRepo string
 		hostname  string
-	}{username, password, imageRepo, hostname})
+		notaryURL string
+	}{username, password, imageRepo, hostname, notaryURL})
 	fake.getContentTrustTokenMutex.Unlock()
 	if fake.GetContentTrustTokenStub != nil {
-		return fake.GetContentTrustTokenStub(username, password, imageRepo, hostname)
+		return fake.GetContentTrustTokenStub(username, password, imageRepo, hostname, notaryURL)
 	}
 	return fake.getContentTrustTokenReturns.token, fake.getContentTrustTokenReturns.err
 }
@@ -63,3 +87,68 @@ func (fake *FakeRegistry) GetContentTrustTokenReturns(token string, err error) {
 		err   error
 	}{token, err}
 }
+
+// InvalidateContentTrustToken ...
+func (fake *FakeRegistry) InvalidateContentTrustToken(username, password, imageRepo, hostname, notaryURL string) {
+	fake.invalidateContentTrustTokenMutex.Lock()
+	fake.invalidateContentTrustTokenArgsForCall = append(fake.invalidateContentTrustTokenArgsForCall, struct {
+		username  string
+		password  string
+		imageRepo string
+		hostname  string
+		notaryURL string
+	}{username, password, imageRepo, hostname, notaryURL})
+	fake.invalidateContentTrustTokenMutex.Unlock()
+	if fake.InvalidateContentTrustTokenStub != nil {
+		fake.InvalidateContentTrustTokenStub(username, password, imageRepo, hostname, notaryURL)
+	}
+}
+
+// InvalidateContentTrustTokenCallCount ...
+func (fake *FakeRegistry) InvalidateContentTrustTokenCallCount() int {
+	fake.invalidateContentTrustTokenMutex.RLock()
+	defer fake.invalidateContentTrustTokenMutex.RUnlock()
+	return len(fake.invalidateContentTrustTokenArgsForCall)
+}
+
+// GetDigest ...
+func (fake *FakeRegistry) GetDigest(username, password, repository, tag, registryURL string) (string, error) {
+	fake.getDigestMutex.Lock()
+	fake.getDigestArgsForCall = append(fake.getDigestArgsForCall, struct {
+		username    string
+		password    string
+		repository  string
+		tag         string
+		registryURL string
+	}{username, password, repository, tag, registryURL})
+	fake.getDigestMutex.Unlock()
+	if fake.GetDigestStub != nil {
+		return fake.GetDigestStub(username, password, repository, tag, registryURL)
+	}
+	return fake.getDigestReturns.digest, fake.getDigestReturns.err
+}
+
+// GetDigestCallCount ...
+func (fake *FakeRegistry) GetDigestCallCount() int {
+	fake.getDigestMutex.RLock()
+	defer fake.getDigestMutex.RUnlock()
+	return len(fake.getDigestArgsForCall)
+}
+
+// GetDigestArgsForCall ...
+func (fake *FakeRegistry) GetDigestArgsForCall(i int) (string, string, string, string, string) {
+	fake.getDigestMutex.RLock()
+	defer fake.getDigestMutex.RUnlock()
+	args := fake.getDigestArgsForCall[i]
+	return args.username, args.password, args.repository, args.tag, args.registryURL
+}
+
+// GetDigestReturns ...
+func (fake *FakeRegistry) GetDigestReturns(digest string, err error) {
+	fake.getDigestMutex.Lock()
+	defer fake.getDigestMutex.Unlock()
+	fake.getDigestReturns = struct {
+		digest string
+		err    error
+	}{digest, err}
+}
@@ -15,27 +15,120 @@
 package registry
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
 	"admission-controller2/helpers/oauth"
 )
 
 // Client .
-type Client struct{}
+type Client struct {
+	tokens *tokenCache
+	// httpClient talks to notary and token servers, it trusts the custom CA as well as the system pool
+	httpClient *http.Client
+}
 
 // Interface .
 type Interface interface {
-	GetContentTrustToken(username, password, imageRepo, hostname string) (string, error)
+	GetContentTrustToken(username, password, imageRepo, hostname, notaryURL string) (string, error)
+	// InvalidateContentTrustToken discards a token the notary server rejected so that the next call gets a new one
+	InvalidateContentTrustToken(username, password, imageRepo, hostname, notaryURL string)
+	// GetDigest returns the digest of the manifest the tag points to, e.g. sha256:2c26b46b...
+	GetDigest(username, password, repository, tag, registryURL string) (string, error)
+}
+
+// manifestMediaTypes are the manifests accepted when resolving a tag, the digest of a manifest list is returned for multi-arch images
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
 }
 
-// NewClient .
-func NewClient() Interface {
-	return &Client{}
+// NewClient creates a client that trusts customCA as well as the system pool when talking to registry, notary and token servers
+func NewClient(customCA []byte) (Interface, error) {
+	httpClient, err := oauth.NewHTTPClient(customCA)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{tokens: newTokenCache(), httpClient: httpClient}, nil
 }
 
-// GetContentTrustToken .
-func (c Client) GetContentTrustToken(username, password, imageRepo, hostname string) (string, error) {
-	token, err := oauth.Request(password, imageRepo, username, false, "notary", hostname)
+// GetContentTrustToken gets a token for the notary server at notaryURL
+// Tokens are cached until shortly before they expire.
+// The notary server is probed for a Docker Registry v2 token authentication challenge,
+// if it does not return one the token is requested from the registry OAuth endpoint at hostname.
+// An error is returned if the notary server cannot be reached.
+func (c Client) GetContentTrustToken(username, password, imageRepo, hostname, notaryURL string) (string, error) {
+	key := newTokenKey(username, password, imageRepo, hostname, notaryURL)
+	if token, ok := c.tokens.get(key); ok {
+		return token, nil
+	}
+
+	token, err := c.requestContentTrustToken(username, password, imageRepo, hostname, notaryURL)
 	if err != nil {
 		return "", err
 	}
+	c.tokens.set(key, token)
 	return token.Token, nil
 }
+
+// InvalidateContentTrustToken .
+func (c Client) InvalidateContentTrustToken(username, password, imageRepo, hostname, notaryURL string) {
+	c.tokens.evict(newTokenKey(username, password, imageRepo, hostname, notaryURL))
+}
+
+// requestContentTrustToken requests a new token from the token server
+func (c Client) requestContentTrustToken(username, password, imageRepo, hostname, notaryURL string) (*oauth.TokenResponse, error) {
+	challenge, err := oauth.GetChallenge(c.httpClient, notaryURL)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return oauth.RequestWithChallenge(c.httpClient, challenge, password, imageRepo, username, false)
+	}
+	return oauth.Request(c.httpClient, password, imageRepo, username, false, "notary", hostname)
+}
+
+// GetDigest returns the digest of the manifest the tag of the repository points to at the registry
+// repository is the name of the repository within the registry, e.g. namespace/name
+// A token is requested with the credentials if the registry challenges for one, otherwise they are sent as basic auth
+func (c Client) GetDigest(username, password, repository, tag, registryURL string) (string, error) {
+	registryURL = strings.TrimSuffix(registryURL, "/")
+	req, err := http.NewRequest(http.MethodHead, fmt.Sprintf("%s/v2/%s/manifests/%s", registryURL, repository, tag), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	challenge, err := oauth.GetChallenge(c.httpClient, registryURL)
+	if err != nil {
+		return "", err
+	}
+	if challenge != nil {
+		token, err := oauth.RequestWithChallenge(c.httpClient, challenge, password, repository, username, false)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+	} else if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Request for manifest %s:%s failed with status code: %v", repository, tag, resp.StatusCode)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("Registry did not return the digest of manifest %s:%s", repository, tag)
+	}
+	return digest, nil
+}
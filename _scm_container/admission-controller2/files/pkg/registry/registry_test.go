@@ -0,0 +1,315 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"admission-controller2/helpers/oauth"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTokenServer creates a stand-in token server that issues token for the test credentials
+func newTokenServer(t *testing.T, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if r.Method != http.MethodGet || !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "notary", r.URL.Query().Get("service"))
+		assert.Equal(t, "repository:test.com/namespace/name:pull", r.URL.Query().Get("scope"))
+		fmt.Fprintf(w, `{"access_token": %q, "expires_in": 300}`, token)
+	}))
+}
+
+// newNotaryServer creates a stand-in notary server that challenges with the realm, or does not ask for auth if realm is empty
+func newNotaryServer(realm string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if realm != "" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q,service="notary"`, realm))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+}
+
+// newLegacyOAuthServer creates a stand-in registry with an IBM style /oauth/token endpoint
+func newLegacyOAuthServer(token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/oauth/token" || r.FormValue("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"token": %q}`, token)
+	}))
+}
+
+func TestClient_GetContentTrustToken(t *testing.T) {
+	tokenServer := newTokenServer(t, "challenge-token")
+	defer tokenServer.Close()
+	challengingNotary := newNotaryServer(tokenServer.URL)
+	defer challengingNotary.Close()
+	openNotary := newNotaryServer("")
+	defer openNotary.Close()
+	legacyRegistry := newLegacyOAuthServer("legacy-token")
+	defer legacyRegistry.Close()
+
+	tests := []struct {
+		name      string
+		password  string
+		notaryURL string
+		wantToken string
+		wantErr   bool
+	}{
+		{
+			name:      "gets a token from the realm of the notary challenge",
+			password:  "secret",
+			notaryURL: challengingNotary.URL,
+			wantToken: "challenge-token",
+		},
+		{
+			name:      "returns an error if the token server rejects the credentials",
+			password:  "wrong",
+			notaryURL: challengingNotary.URL,
+			wantErr:   true,
+		},
+		{
+			name:      "falls back to registry OAuth if the notary server does not challenge",
+			password:  "secret",
+			notaryURL: openNotary.URL,
+			wantToken: "legacy-token",
+		},
+		{
+			name:      "returns an error if the notary server cannot be reached",
+			password:  "secret",
+			notaryURL: "http://127.0.0.1:0",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(nil)
+			assert.NoError(t, err)
+			token, err := client.GetContentTrustToken("user", tt.password, "test.com/namespace/name", legacyRegistry.URL, tt.notaryURL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantToken, token)
+		})
+	}
+}
+
+func TestClient_GetContentTrustToken_CustomCA(t *testing.T) {
+	tokenServer := newTokenServer(t, "challenge-token")
+	defer tokenServer.Close()
+	plainNotary := newNotaryServer(tokenServer.URL)
+	defer plainNotary.Close()
+	notary := httptest.NewTLSServer(plainNotary.Config.Handler)
+	defer notary.Close()
+	customCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: notary.Certificate().Raw})
+
+	client, err := NewClient(customCA)
+	assert.NoError(t, err)
+	token, err := client.GetContentTrustToken("user", "secret", "test.com/namespace/name", "https://test.com", notary.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "challenge-token", token, "should trust the notary server signed by the custom CA")
+
+	client, err = NewClient(nil)
+	assert.NoError(t, err)
+	_, err = client.GetContentTrustToken("user", "secret", "test.com/namespace/name", "https://test.com", notary.URL)
+	assert.Error(t, err, "should not fall back to registry OAuth if the notary server is not trusted")
+
+	plainOpenNotary := newNotaryServer("")
+	defer plainOpenNotary.Close()
+	openNotary := httptest.NewTLSServer(plainOpenNotary.Config.Handler)
+	defer openNotary.Close()
+	plainLegacyRegistry := newLegacyOAuthServer("legacy-token")
+	defer plainLegacyRegistry.Close()
+	legacyRegistry := httptest.NewTLSServer(plainLegacyRegistry.Config.Handler)
+	defer legacyRegistry.Close()
+
+	client, err = NewClient(customCA)
+	assert.NoError(t, err)
+	token, err = client.GetContentTrustToken("user", "secret", "test.com/namespace/name", legacyRegistry.URL, openNotary.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-token", token, "should trust the registry signed by the custom CA when falling back to registry OAuth")
+}
+
+func TestClient_GetContentTrustToken_Cache(t *testing.T) {
+	var requests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		fmt.Fprintf(w, `{"token": "token-%d", "expires_in": 300}`, n)
+	}))
+	defer tokenServer.Close()
+	notary := newNotaryServer(tokenServer.URL)
+	defer notary.Close()
+
+	now := time.Now()
+	client := &Client{tokens: newTokenCache(), httpClient: http.DefaultClient}
+	client.tokens.now = func() time.Time { return now }
+	getToken := func(password, imageRepo string) string {
+		token, err := client.GetContentTrustToken("user", password, imageRepo, "https://test.com", notary.URL)
+		assert.NoError(t, err)
+		return token
+	}
+
+	assert.Equal(t, "token-1", getToken("secret", "test.com/namespace/name"))
+	assert.Equal(t, "token-1", getToken("secret", "test.com/namespace/name"), "should use the cached token")
+	assert.Equal(t, "token-2", getToken("other", "test.com/namespace/name"), "should not share tokens between credentials")
+	assert.Equal(t, "token-3", getToken("secret", "test.com/namespace/other"), "should not share tokens between repositories")
+
+	now = now.Add(300*time.Second - tokenExpiryMargin)
+	assert.Equal(t, "token-4", getToken("secret", "test.com/namespace/name"), "should not use a token within the expiry margin")
+
+	client.InvalidateContentTrustToken("user", "secret", "test.com/namespace/name", "https://test.com", notary.URL)
+	assert.Equal(t, "token-5", getToken("secret", "test.com/namespace/name"), "should not use an evicted token")
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests))
+}
+
+func TestTokenCache_set(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		token       *oauth.TokenResponse
+		wantExpires time.Time
+		wantCached  bool
+	}{
+		{
+			name:        "uses the default lifetime if expires_in is not set",
+			token:       &oauth.TokenResponse{Token: "token"},
+			wantExpires: now.Add(defaultTokenLifetime - tokenExpiryMargin),
+			wantCached:  true,
+		},
+		{
+			name:        "counts the lifetime from issued_at",
+			token:       &oauth.TokenResponse{Token: "token", ExpiresIn: 120, IssuedAt: now.Add(-30 * time.Second)},
+			wantExpires: now.Add(90*time.Second - tokenExpiryMargin),
+			wantCached:  true,
+		},
+		{
+			name:  "does not cache tokens that expire within the margin",
+			token: &oauth.TokenResponse{Token: "token", ExpiresIn: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newTokenCache()
+			cache.now = func() time.Time { return now }
+			key := newTokenKey("user", "secret", "test.com/namespace/name", "https://test.com", "https://notary.test.com")
+			cache.set(key, tt.token)
+			cached, ok := cache.tokens[key]
+			assert.Equal(t, tt.wantCached, ok)
+			if tt.wantCached {
+				assert.True(t, tt.wantExpires.Equal(cached.expires), "expected expiry %v, got %v", tt.wantExpires, cached.expires)
+			}
+		})
+	}
+}
+
+// newRegistryServer creates a stand-in registry with a manifest for namespace/name:v1 that challenges with the realm, or does not ask for auth if realm is empty
+func newRegistryServer(t *testing.T, realm, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if realm != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q,service="registry"`, realm))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		if r.Method != http.MethodHead || r.URL.Path != "/v2/namespace/name/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Contains(t, r.Header.Get("Accept"), "application/vnd.docker.distribution.manifest.v2+json")
+		w.Header().Set("Docker-Content-Digest", "sha256:0123456789abcdef")
+	}))
+}
+
+func TestClient_GetDigest(t *testing.T) {
+	var scope string
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		scope = r.URL.Query().Get("scope")
+		fmt.Fprint(w, `{"token": "registry-token"}`)
+	}))
+	defer tokenServer.Close()
+	challengingRegistry := newRegistryServer(t, tokenServer.URL, "registry-token")
+	defer challengingRegistry.Close()
+	openRegistry := newRegistryServer(t, "", "")
+	defer openRegistry.Close()
+
+	tests := []struct {
+		name        string
+		password    string
+		tag         string
+		registryURL string
+		wantDigest  string
+		wantErr     bool
+	}{
+		{
+			name:        "gets the digest with a token from the realm of the registry challenge",
+			password:    "secret",
+			tag:         "v1",
+			registryURL: challengingRegistry.URL,
+			wantDigest:  "sha256:0123456789abcdef",
+		},
+		{
+			name:        "returns an error if the token server rejects the credentials",
+			password:    "wrong",
+			tag:         "v1",
+			registryURL: challengingRegistry.URL,
+			wantErr:     true,
+		},
+		{
+			name:        "gets the digest from a registry that does not challenge",
+			tag:         "v1",
+			registryURL: openRegistry.URL,
+			wantDigest:  "sha256:0123456789abcdef",
+		},
+		{
+			name:        "returns an error if the tag does not exist",
+			tag:         "v2",
+			registryURL: openRegistry.URL,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(nil)
+			assert.NoError(t, err)
+			digest, err := client.GetDigest("user", tt.password, "namespace/name", tt.tag, tt.registryURL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDigest, digest)
+		})
+	}
+	assert.Equal(t, "repository:namespace/name:pull", scope)
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeva
+
+import (
+	"sync"
+
+	"admission-controller2/pkg/va"
+)
+
+var _ va.Interface = &FakeScanner{}
+
+// FakeScanner .
+type FakeScanner struct {
+	GetReportStub        func(image, digest string) (*va.Report, error)
+	getReportMutex       sync.RWMutex
+	getReportArgsForCall []struct {
+		image  string
+		digest string
+	}
+	getReportReturns struct {
+		report *va.Report
+		err    error
+	}
+}
+
+// GetReport ...
+func (fake *FakeScanner) GetReport(image, digest string) (*va.Report, error) {
+	fake.getReportMutex.Lock()
+	fake.getReportArgsForCall = append(fake.getReportArgsForCall, struct {
+		image  string
+		digest string
+	}{image, digest})
+	fake.getReportMutex.Unlock()
+	if fake.GetReportStub != nil {
+		return fake.GetReportStub(image, digest)
+	}
+	return fake.getReportReturns.report, fake.getReportReturns.err
+}
+
+// GetReportCallCount ...
+func (fake *FakeScanner) GetReportCallCount() int {
+	fake.getReportMutex.RLock()
+	defer fake.getReportMutex.RUnlock()
+	return len(fake.getReportArgsForCall)
+}
+
+// GetReportArgsForCall ...
+func (fake *FakeScanner) GetReportArgsForCall(i int) (string, string) {
+	fake.getReportMutex.RLock()
+	defer fake.getReportMutex.RUnlock()
+	return fake.getReportArgsForCall[i].image, fake.getReportArgsForCall[i].digest
+}
+
+// GetReportReturns ...
+func (fake *FakeScanner) GetReportReturns(report *va.Report, err error) {
+	fake.getReportMutex.Lock()
+	defer fake.getReportMutex.Unlock()
+	fake.getReportReturns = struct {
+		report *va.Report
+		err    error
+	}{report, err}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeva
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"admission-controller2/pkg/va"
+)
+
+// Server is a stand-in vulnerability scanner serving the HTTP API used by va.Client
+// It serves the reports it has been given, looked up by digest and then by image
+type Server struct {
+	mutex   sync.RWMutex
+	reports map[string]*va.Report
+}
+
+// NewServer creates a stand-in scanner with no reports
+func NewServer() *Server {
+	return &Server{reports: map[string]*va.Report{}}
+}
+
+// AddReport adds a report that is served for its digest, or its image if it has no digest
+func (s *Server) AddReport(report *va.Report) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if report.Digest != "" {
+		s.reports[report.Digest] = report
+	} else {
+		s.reports[report.Image] = report
+	}
+}
+
+// ServeHTTP serves GET /reports?image=<image>&digest=<digest>
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.Path != "/reports" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mutex.RLock()
+	report, ok := s.reports[r.URL.Query().Get("digest")]
+	if !ok {
+		report, ok = s.reports[r.URL.Query().Get("image")]
+	}
+	s.mutex.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
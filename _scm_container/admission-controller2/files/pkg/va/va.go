@@ -0,0 +1,172 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package va
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Severities of a vulnerability, in increasing order of severity
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// DefaultThreshold is the severity used when a policy does not set a threshold
+const DefaultThreshold = SeverityHigh
+
+var severityRank = map[string]int{
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// ErrReportNotFound is returned when the scanner has no report for the image, for example because it has not been scanned yet
+var ErrReportNotFound = fmt.Errorf("no vulnerability report found")
+
+// Vulnerability is a single vulnerability found in an image
+type Vulnerability struct {
+	// ID is the identifier of the vulnerability e.g. CVE-2018-1234
+	ID       string `json:"id"`
+	Severity string `json:"severity"`
+	Package  string `json:"package,omitempty"`
+}
+
+// Report is the vulnerability report for an image digest
+type Report struct {
+	Image           string          `json:"image,omitempty"`
+	Digest          string          `json:"digest"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// Interface is a vulnerability scanner that reports the known vulnerabilities of an image
+type Interface interface {
+	GetReport(image, digest string) (*Report, error)
+}
+
+// Client is a vulnerability scanner client that retrieves reports over HTTP
+// Reports are requested with GET <url>/reports?image=<image>&digest=<digest>
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the scanner served at the url
+func NewClient(scannerURL string) Interface {
+	return &Client{
+		url: strings.TrimSuffix(scannerURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				Dial: (&net.Dialer{
+					Timeout:   5 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).Dial,
+				MaxIdleConnsPerHost: 10,
+				TLSHandshakeTimeout: 5 * time.Second,
+			},
+		},
+	}
+}
+
+// GetReport retrieves the vulnerability report for the image digest
+// If digest is empty the scanner reports on the image tag
+func (c *Client) GetReport(image, digest string) (*Report, error) {
+	query := url.Values{"image": {image}}
+	if digest != "" {
+		query.Set("digest", digest)
+	}
+	resp, err := c.httpClient.Get(c.url + "/reports?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrReportNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Request to vulnerability scanner failed with status code: %v and body: %s", resp.StatusCode, body)
+	}
+
+	report := Report{}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshall vulnerability report: %s", err)
+	}
+	return &report, nil
+}
+
+// ValidSeverity returns true if the severity is one the scanner reports
+func ValidSeverity(severity string) bool {
+	_, ok := severityRank[strings.ToLower(severity)]
+	return ok
+}
+
+// StricterThreshold returns the threshold that denies more images, an empty threshold is the DefaultThreshold
+// A threshold that is not a valid severity is returned in preference to a valid one, so that it is reported rather than ignored
+func StricterThreshold(a, b string) string {
+	if a == "" {
+		a = DefaultThreshold
+	}
+	if b == "" {
+		b = DefaultThreshold
+	}
+	if severityRank[strings.ToLower(b)] < severityRank[strings.ToLower(a)] {
+		return b
+	}
+	return a
+}
+
+// Failures returns the vulnerabilities in the report at or above the threshold severity that are not exempt
+// An empty threshold uses the DefaultThreshold
+func (r Report) Failures(threshold string, exemptions []string) []Vulnerability {
+	if threshold == "" {
+		threshold = DefaultThreshold
+	}
+	minRank := severityRank[strings.ToLower(threshold)]
+
+	exempt := map[string]bool{}
+	for _, id := range exemptions {
+		exempt[id] = true
+	}
+
+	failures := []Vulnerability{}
+	for _, vulnerability := range r.Vulnerabilities {
+		if exempt[vulnerability.ID] {
+			continue
+		}
+		// Unknown severities are treated as the most severe so they are never silently allowed
+		rank, ok := severityRank[strings.ToLower(vulnerability.Severity)]
+		if !ok {
+			rank = severityRank[SeverityCritical]
+		}
+		if rank >= minRank {
+			failures = append(failures, vulnerability)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package va_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"admission-controller2/pkg/va"
+	"admission-controller2/pkg/va/fakeva"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_GetReport(t *testing.T) {
+	scanner := fakeva.NewServer()
+	scanner.AddReport(&va.Report{
+		Digest: "sha256:1234",
+		Vulnerabilities: []va.Vulnerability{
+			{ID: "CVE-2018-0001", Severity: va.SeverityHigh},
+		},
+	})
+	scanner.AddReport(&va.Report{
+		Image: "test.com/namespace/name:latest",
+	})
+	server := httptest.NewServer(scanner)
+	defer server.Close()
+
+	tests := []struct {
+		name                   string
+		image                  string
+		digest                 string
+		wantErr                error
+		wantVulnerabilityCount int
+	}{
+		{
+			name:                   "returns the report for a digest",
+			image:                  "test.com/namespace/other:latest",
+			digest:                 "sha256:1234",
+			wantVulnerabilityCount: 1,
+		},
+		{
+			name:  "returns the report for an image when there is no digest",
+			image: "test.com/namespace/name:latest",
+		},
+		{
+			name:    "returns ErrReportNotFound when the image has not been scanned",
+			image:   "test.com/namespace/unknown:latest",
+			digest:  "sha256:5678",
+			wantErr: va.ErrReportNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := va.NewClient(server.URL + "/")
+			report, err := client.GetReport(tt.image, tt.digest)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Len(t, report.Vulnerabilities, tt.wantVulnerabilityCount)
+			}
+		})
+	}
+}
+
+func TestReport_Failures(t *testing.T) {
+	report := va.Report{
+		Vulnerabilities: []va.Vulnerability{
+			{ID: "CVE-2018-0001", Severity: va.SeverityLow},
+			{ID: "CVE-2018-0002", Severity: va.SeverityMedium},
+			{ID: "CVE-2018-0003", Severity: "HIGH"},
+			{ID: "CVE-2018-0004", Severity: va.SeverityCritical},
+			{ID: "CVE-2018-0005", Severity: "unknown"},
+		},
+	}
+	tests := []struct {
+		name       string
+		threshold  string
+		exemptions []string
+		want       []string
+	}{
+		{
+			name: "uses the default threshold when none is set",
+			want: []string{"CVE-2018-0003", "CVE-2018-0004", "CVE-2018-0005"},
+		},
+		{
+			name:      "includes everything at or above a low threshold",
+			threshold: va.SeverityLow,
+			want:      []string{"CVE-2018-0001", "CVE-2018-0002", "CVE-2018-0003", "CVE-2018-0004", "CVE-2018-0005"},
+		},
+		{
+			name:      "treats unknown severities as critical",
+			threshold: va.SeverityCritical,
+			want:      []string{"CVE-2018-0004", "CVE-2018-0005"},
+		},
+		{
+			name:       "skips exempt vulnerabilities",
+			threshold:  va.SeverityMedium,
+			exemptions: []string{"CVE-2018-0002", "CVE-2018-0005"},
+			want:       []string{"CVE-2018-0003", "CVE-2018-0004"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []string{}
+			for _, vulnerability := range report.Failures(tt.threshold, tt.exemptions) {
+				ids = append(ids, vulnerability.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func TestValidSeverity(t *testing.T) {
+	assert.True(t, va.ValidSeverity("medium"))
+	assert.True(t, va.ValidSeverity("Critical"))
+	assert.False(t, va.ValidSeverity("severe"))
+	assert.False(t, va.ValidSeverity(""))
+}
+
+func TestStricterThreshold(t *testing.T) {
+	assert.Equal(t, va.SeverityLow, va.StricterThreshold(va.SeverityLow, va.SeverityCritical))
+	assert.Equal(t, va.SeverityMedium, va.StricterThreshold("", va.SeverityMedium))
+	assert.Equal(t, va.DefaultThreshold, va.StricterThreshold(va.SeverityCritical, ""))
+	assert.Equal(t, "severe", va.StricterThreshold(va.SeverityLow, "severe"))
+}
@@ -0,0 +1,93 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"time"
+
+	"admission-controller2/pkg/metrics"
+	"github.com/golang/glog"
+)
+
+// SetCertificate parses the PEM encoded certificate and key and atomically replaces the certificate being served
+// Connections that are already established keep the certificate they were created with
+func (s *Server) SetCertificate(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+
+	rotated := s.getCertificate() != nil
+	s.certificate.Store(&cert)
+	metrics.CertificateExpiry.Set(float64(leaf.NotAfter.Unix()))
+	if rotated {
+		metrics.CertificateRotations.Inc()
+		glog.Infof("Rotated %v Webhook serving certificate, serial %s expires %v", s.name, leaf.SerialNumber, leaf.NotAfter)
+	} else {
+		glog.Infof("Loaded %v Webhook serving certificate, serial %s expires %v", s.name, leaf.SerialNumber, leaf.NotAfter)
+	}
+	return nil
+}
+
+// getCertificate returns the certificate being served, or nil if none has been loaded
+func (s *Server) getCertificate() *tls.Certificate {
+	cert, _ := s.certificate.Load().(*tls.Certificate)
+	return cert
+}
+
+// WatchCertificateFiles polls the certificate and key files every interval until stopCh is closed,
+// and serves the new certificate when their contents change.
+// The files are read rather than watched for events because Secret volumes are updated by swapping a symlink.
+// If the new files cannot be loaded, for example while only one of them has been written, the current certificate is kept.
+func (s *Server) WatchCertificateFiles(certFile, keyFile string, interval time.Duration, stopCh <-chan struct{}) {
+	lastCert, lastKey := s.serverCert, s.serverKey
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		certPEM, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			glog.Errorf("Could not read %s: %v", certFile, err)
+			continue
+		}
+		keyPEM, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			glog.Errorf("Could not read %s: %v", keyFile, err)
+			continue
+		}
+		if bytes.Equal(certPEM, lastCert) && bytes.Equal(keyPEM, lastKey) {
+			continue
+		}
+		if err := s.SetCertificate(certPEM, keyPEM); err != nil {
+			glog.Errorf("Could not load certificate from %s and %s, keeping the current certificate: %v", certFile, keyFile, err)
+			continue
+		}
+		lastCert, lastKey = certPEM, keyPEM
+	}
+}
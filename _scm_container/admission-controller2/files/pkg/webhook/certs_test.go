@@ -0,0 +1,93 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"admission-controller2/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serialOf returns the serial number of a PEM encoded certificate
+func serialOf(t *testing.T, certPEM []byte) string {
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	return cert.SerialNumber.String()
+}
+
+func TestServer_SetCertificate(t *testing.T) {
+	server := getTestWebhookServer()
+	firstCert, firstKey := generateTestCert(t, "first", nil)
+	secondCert, secondKey := generateTestCert(t, "second", nil)
+	rotations := testutil.ToFloat64(metrics.CertificateRotations)
+
+	assert.Error(t, server.SetCertificate([]byte("bad"), firstKey))
+	assert.Nil(t, server.getCertificate())
+
+	require.NoError(t, server.SetCertificate(firstCert, firstKey))
+	assert.Equal(t, serialOf(t, firstCert), server.getCertificate().Leaf.SerialNumber.String())
+	assert.Equal(t, rotations, testutil.ToFloat64(metrics.CertificateRotations), "loading the first certificate is not a rotation")
+
+	require.NoError(t, server.SetCertificate(secondCert, secondKey))
+	assert.Equal(t, serialOf(t, secondCert), server.getCertificate().Leaf.SerialNumber.String())
+	assert.Equal(t, rotations+1, testutil.ToFloat64(metrics.CertificateRotations))
+}
+
+func TestServer_WatchCertificateFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook-certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "serverCert.pem"), filepath.Join(dir, "serverKey.pem")
+
+	firstCert, firstKey := generateTestCert(t, "first", nil)
+	require.NoError(t, ioutil.WriteFile(certFile, firstCert, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, firstKey, 0600))
+	server := NewServer("test", nil, firstCert, firstKey)
+	require.NoError(t, server.SetCertificate(firstCert, firstKey))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go server.WatchCertificateFiles(certFile, keyFile, 10*time.Millisecond, stopCh)
+
+	waitForSerial := func(want string) {
+		for i := 0; i < 200; i++ {
+			if server.getCertificate().Leaf.SerialNumber.String() == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("certificate with serial %s was not loaded", want)
+	}
+
+	// A cert that does not match the key is ignored
+	secondCert, secondKey := generateTestCert(t, "second", nil)
+	require.NoError(t, ioutil.WriteFile(certFile, secondCert, 0600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, serialOf(t, firstCert), server.getCertificate().Leaf.SerialNumber.String())
+
+	// Once the key is written too the new certificate is served
+	require.NoError(t, ioutil.WriteFile(keyFile, secondKey, 0600))
+	waitForSerial(serialOf(t, secondCert))
+}
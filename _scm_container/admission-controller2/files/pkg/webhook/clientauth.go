@@ -0,0 +1,53 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+// requireClientCertificate rejects requests that did not present a verified client certificate with an allowed subject
+func (s *Server) requireClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			glog.Warningf("Rejected %s request from %s without a verified client certificate", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		cert := r.TLS.VerifiedChains[0][0]
+		if !s.clientSubjectAllowed(cert) {
+			glog.Warningf("Rejected %s request from %s with client certificate subject %q", r.URL.Path, r.RemoteAddr, cert.Subject.String())
+			http.Error(w, "client certificate subject not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientSubjectAllowed returns true if the certificate's common name or full subject is in the allow-list, or the allow-list is empty
+func (s *Server) clientSubjectAllowed(cert *x509.Certificate) bool {
+	if len(s.allowedClientSubjects) == 0 {
+		return true
+	}
+	for _, subject := range s.allowedClientSubjects {
+		if subject == cert.Subject.CommonName || subject == cert.Subject.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"admission-controller2/pkg/controller/fakecontroller"
+	"admission-controller2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_ClientAuth(t *testing.T) {
+	serverCert, serverKey := generateTestCert(t, "webhook", nil)
+
+	caCert, caKey := generateTestCert(t, "client-ca", nil)
+	ca, err := tls.X509KeyPair(caCert, caKey)
+	require.NoError(t, err)
+	newClientCert := func(commonName string, parent *tls.Certificate) *tls.Certificate {
+		cert, err := tls.X509KeyPair(generateTestCert(t, commonName, parent))
+		require.NoError(t, err)
+		return &cert
+	}
+	apiserverCert := newClientCert("kube-apiserver", &ca)
+	otherCert := newClientCert("other", &ca)
+	untrustedCert := newClientCert("kube-apiserver", nil)
+
+	addr := freeAddr(t)
+	server := NewServer("test", &fakecontroller.Controller{}, serverCert, serverKey,
+		WithAddr(addr),
+		WithClientAuth(caCert, []string{"kube-apiserver"}),
+	)
+	stopCh := make(chan struct{})
+	runErr := make(chan error, 1)
+	go func() { runErr <- server.Run(stopCh) }()
+	defer func() {
+		close(stopCh)
+		assert.NoError(t, <-runErr)
+	}()
+	waitForServer(t, addr)
+
+	admit := func(clientCert *tls.Certificate) (int, error) {
+		body, _ := json.Marshal(types.AdmissionReview{Request: &types.AdmissionRequest{UID: "requestUID"}})
+		resp, err := testClient(t, serverCert, clientCert).Post("https://"+addr+"/admit", "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	tests := []struct {
+		name       string
+		clientCert *tls.Certificate
+		wantCode   int
+		wantErr    bool
+	}{
+		{
+			name:       "Allows a client certificate with an allowed subject",
+			clientCert: apiserverCert,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:     "Rejects callers without a client certificate",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "Rejects a client certificate with a subject that is not allowed",
+			clientCert: otherCert,
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Rejects a client certificate that is not signed by the CA",
+			clientCert: untrustedCert,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := admit(tt.clientCert)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCode, code)
+		})
+	}
+
+	t.Run("Allows probes without a client certificate", func(t *testing.T) {
+		resp, err := testClient(t, serverCert, nil).Get("https://" + addr + "/healthz")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestServer_ClientAuthInvalidCA(t *testing.T) {
+	serverCert, serverKey := generateTestCert(t, "webhook", nil)
+	server := NewServer("test", &fakecontroller.Controller{}, serverCert, serverKey,
+		WithAddr(freeAddr(t)),
+		WithClientAuth([]byte("not a certificate"), nil),
+		WithShutdownGracePeriod(time.Second),
+	)
+	assert.Error(t, server.Run(make(chan struct{})))
+}
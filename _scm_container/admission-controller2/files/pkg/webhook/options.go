@@ -0,0 +1,83 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"time"
+)
+
+// Default server settings, used unless overridden by an Option
+const (
+	DefaultAddr                = ":8000"
+	DefaultReadTimeout         = 30 * time.Second
+	DefaultWriteTimeout        = 30 * time.Second
+	DefaultIdleTimeout         = 120 * time.Second
+	DefaultShutdownGracePeriod = 30 * time.Second
+)
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithAddr sets the address the server listens on, e.g. ":8000"
+func WithAddr(addr string) Option {
+	return func(s *Server) {
+		s.addr = addr
+	}
+}
+
+// WithReadTimeout sets the maximum duration for reading an entire request
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the maximum duration before timing out writes of a response
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = timeout
+	}
+}
+
+// WithIdleTimeout sets the maximum time to wait for the next request on a keep-alive connection
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithShutdownDelay sets how long the server keeps serving while reporting not ready before it starts shutting down,
+// giving the api server time to stop routing admissions to it
+func WithShutdownDelay(delay time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownDelay = delay
+	}
+}
+
+// WithShutdownGracePeriod sets how long in-flight admissions are given to complete when the server shuts down
+func WithShutdownGracePeriod(period time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownGracePeriod = period
+	}
+}
+
+// WithClientAuth requires callers of /admit to present a client certificate signed by a CA in the PEM encoded caBundle
+// If allowedSubjects is not empty the certificate's common name or full subject must be one of them
+func WithClientAuth(caBundle []byte, allowedSubjects []string) Option {
+	return func(s *Server) {
+		s.clientCA = caBundle
+		s.allowedClientSubjects = allowedSubjects
+	}
+}
@@ -19,38 +19,44 @@ import (
 	"net/http"
 	"strings"
 
+	"admission-controller2/types"
 	"github.com/golang/glog"
-	"k8s.io/api/admission/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // AdmissionResponder is a helper for handling admission response creation
-// It supports adding and returning multiple errors to the user
+// It supports adding and returning multiple errors and warnings to the user
 type AdmissionResponder struct {
-	allowed bool
-	errors  []string
-	patches []byte
+	allowed          bool
+	errors           []string
+	warnings         []string
+	auditAnnotations map[string]string
+	patches          []byte
 }
 
 // Flush creates the admission response to return
-func (a *AdmissionResponder) Flush() *v1beta1.AdmissionResponse {
+func (a *AdmissionResponder) Flush() *types.AdmissionResponse {
 	if a.allowed && !a.HasErrors() {
-		res := &v1beta1.AdmissionResponse{
-			Allowed: true,
+		res := &types.AdmissionResponse{
+			Allowed:          true,
+			Warnings:         a.warnings,
+			AuditAnnotations: a.auditAnnotations,
 		}
 
 		if a.patches != nil {
 			res.Patch = a.patches
-			pt := v1beta1.PatchTypeJSONPatch
+			pt := types.PatchTypeJSONPatch
 			res.PatchType = &pt
 		}
 		return res
 	}
-	return &v1beta1.AdmissionResponse{
+	return &types.AdmissionResponse{
 		Allowed: false,
 		Result: &metav1.Status{
 			Message: fmt.Sprintf("\n%s", strings.Join(a.errors, "\n")),
 		},
+		Warnings:         a.warnings,
+		AuditAnnotations: a.auditAnnotations,
 	}
 }
 
@@ -75,7 +81,7 @@ func (a *AdmissionResponder) SetPatch(patch []byte) {
 }
 
 // Write writes the output of flush to the passed responsewriter
-func (a *AdmissionResponder) Write(w http.ResponseWriter, ar v1beta1.AdmissionReview) {
+func (a *AdmissionResponder) Write(w http.ResponseWriter, ar types.AdmissionReview) {
 	resp := reviewResponseToByte(a.Flush(), ar)
 	if _, err := w.Write(resp); err != nil {
 		glog.Error(err)
@@ -92,3 +98,16 @@ func (a *AdmissionResponder) ToAdmissionResponse(err error) {
 func (a *AdmissionResponder) StringToAdmissionResponse(msg string) {
 	a.errors = append(a.errors, msg)
 }
+
+// AddWarning adds a warning to the response, warnings do not affect whether the admission is allowed
+func (a *AdmissionResponder) AddWarning(msg string) {
+	a.warnings = append(a.warnings, msg)
+}
+
+// AddAuditAnnotation adds an annotation to the audit event of the request, it is not shown to the user
+func (a *AdmissionResponder) AddAuditAnnotation(key, value string) {
+	if a.auditAnnotations == nil {
+		a.auditAnnotations = map[string]string{}
+	}
+	a.auditAnnotations[key] = value
+}
@@ -40,4 +40,26 @@ func TestAdmissionResponder(t *testing.T) {
 		assert.Equal(t, string(patch), string(resp.Patch))
 		assert.True(t, resp.Allowed)
 	})
+
+	t.Run("should include the warnings in the response", func(t *testing.T) {
+		responder := &AdmissionResponder{}
+		responder.AddWarning("FAKE_WARNING")
+		responder.SetAllowed()
+		resp := responder.Flush()
+		assert.Equal(t, []string{"FAKE_WARNING"}, resp.Warnings)
+		assert.True(t, resp.Allowed)
+
+		responder.StringToAdmissionResponse("FAKE_ERROR")
+		resp = responder.Flush()
+		assert.Equal(t, []string{"FAKE_WARNING"}, resp.Warnings)
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("should include the audit annotations in the response", func(t *testing.T) {
+		responder := &AdmissionResponder{}
+		responder.AddAuditAnnotation("key", "value")
+		responder.SetAllowed()
+		resp := responder.Flush()
+		assert.Equal(t, map[string]string{"key": "value"}, resp.AuditAnnotations)
+	})
 }
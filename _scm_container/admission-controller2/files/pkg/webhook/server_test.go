@@ -0,0 +1,158 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"admission-controller2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingController admits once release is closed, signalling on started when an admission begins
+type blockingController struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingController) Admit(admissionRequest *types.AdmissionRequest) *types.AdmissionResponse {
+	close(c.started)
+	<-c.release
+	return &types.AdmissionResponse{Allowed: true}
+}
+
+// generateTestCert generates a self signed serving certificate for 127.0.0.1, signed by parent if it is not nil
+func generateTestCert(t *testing.T, commonName string, parent *tls.Certificate) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, err = x509.ParseCertificate(parent.Certificate[0])
+		require.NoError(t, err)
+		signerKey = parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// freeAddr returns a local address that is free to listen on
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// testClient returns a client that trusts the PEM encoded CA
+func testClient(t *testing.T, caPEM []byte, clientCert *tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(caPEM))
+	config := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		// Always present the certificate, even if it is not signed by a CA the server asks for
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return clientCert, nil
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: 10 * time.Second}
+}
+
+// waitForServer waits until the server at addr accepts connections
+func waitForServer(t *testing.T, addr string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not start on %s", addr)
+}
+
+func TestServer_Run(t *testing.T) {
+	certPEM, keyPEM := generateTestCert(t, "webhook", nil)
+
+	t.Run("Returns an error if the certificate is invalid", func(t *testing.T) {
+		server := NewServer("test", &blockingController{}, []byte("bad"), keyPEM, WithAddr(freeAddr(t)))
+		assert.Error(t, server.Run(make(chan struct{})))
+	})
+
+	t.Run("Returns an error if the address cannot be listened on", func(t *testing.T) {
+		server := NewServer("test", &blockingController{}, certPEM, keyPEM, WithAddr("256.0.0.1:0"))
+		assert.Error(t, server.Run(make(chan struct{})))
+	})
+
+	t.Run("Completes in-flight admissions when stopped", func(t *testing.T) {
+		addr := freeAddr(t)
+		ctrl := &blockingController{started: make(chan struct{}), release: make(chan struct{})}
+		server := NewServer("test", ctrl, certPEM, keyPEM, WithAddr(addr), WithShutdownGracePeriod(5*time.Second))
+		stopCh := make(chan struct{})
+		runErr := make(chan error, 1)
+		go func() { runErr <- server.Run(stopCh) }()
+		waitForServer(t, addr)
+
+		type result struct {
+			resp *http.Response
+			err  error
+		}
+		results := make(chan result, 1)
+		go func() {
+			body, _ := json.Marshal(types.AdmissionReview{Request: &types.AdmissionRequest{UID: "requestUID"}})
+			resp, err := testClient(t, certPEM, nil).Post("https://"+addr+"/admit", "application/json", bytes.NewBuffer(body))
+			results <- result{resp, err}
+		}()
+
+		<-ctrl.started
+		close(stopCh)
+		// Give the server time to start shutting down before the admission completes
+		time.Sleep(100 * time.Millisecond)
+		close(ctrl.release)
+
+		r := <-results
+		require.NoError(t, r.err)
+		assert.Equal(t, http.StatusOK, r.resp.StatusCode)
+		r.resp.Body.Close()
+		assert.NoError(t, <-runErr)
+		assert.Equal(t, int32(1), server.shuttingDown)
+	})
+}
@@ -15,24 +15,31 @@
 package webhook
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"admission-controller2/pkg/controller"
-	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"admission-controller2/pkg/metrics"
+	"admission-controller2/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 )
 
-var codec = serializer.NewCodecFactory(runtime.NewScheme())
-
 // Server is the admission webhook server
 type Server struct {
 	name string
@@ -42,31 +49,78 @@ type Server struct {
 	controller controller.Interface
 
 	serverCert, serverKey []byte
+
+	// addr is the address the server listens on
+	addr string
+	// clientCA is the PEM encoded CA bundle client certificates are verified against, nil if client certificates are not required
+	clientCA []byte
+	// allowedClientSubjects restricts the subjects of client certificates that may call /admit, any subject is allowed if it is empty
+	allowedClientSubjects []string
+	// Timeouts of the http server
+	readTimeout, writeTimeout, idleTimeout time.Duration
+	// shutdownDelay is how long the server reports not ready before it stops accepting connections
+	shutdownDelay time.Duration
+	// shutdownGracePeriod is how long in-flight admissions are given to complete on shutdown
+	shutdownGracePeriod time.Duration
+
+	// certificate holds the *tls.Certificate currently being served, it is swapped when the certificate is rotated
+	certificate atomic.Value
+	// shuttingDown is set to 1 once the server has been told to shut down
+	shuttingDown int32
+	// readinessChecks must all pass for the server to report ready
+	readinessChecks      []readinessCheck
+	readinessChecksMutex sync.RWMutex
+}
+
+// ReadinessCheck returns an error if a dependency of the server is not ready
+type ReadinessCheck func() error
+
+type readinessCheck struct {
+	name  string
+	check ReadinessCheck
 }
 
 // NewServer creates a new admission webhook server with the passed controller handling the admissions
-func NewServer(name string, ctrl controller.Interface, cert, key []byte) *Server {
-	return &Server{
-		name:       name,
-		mux:        http.NewServeMux(),
-		controller: ctrl,
-		serverCert: cert,
-		serverKey:  key,
+func NewServer(name string, ctrl controller.Interface, cert, key []byte, opts ...Option) *Server {
+	s := &Server{
+		name:                name,
+		mux:                 http.NewServeMux(),
+		controller:          ctrl,
+		serverCert:          cert,
+		serverKey:           key,
+		addr:                DefaultAddr,
+		readTimeout:         DefaultReadTimeout,
+		writeTimeout:        DefaultWriteTimeout,
+		idleTimeout:         DefaultIdleTimeout,
+		shutdownGracePeriod: DefaultShutdownGracePeriod,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // HandleAdmissionRequest handles an incoming request and calls the controllers admit function
-// It writes the response from the Admit to the response writer
+// It accepts admission.k8s.io/v1beta1 and admission.k8s.io/v1 AdmissionReviews
+// It writes the response from the Admit to the response writer in the same version as the request
 func (s *Server) HandleAdmissionRequest(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 	body, _ := ioutil.ReadAll(r.Body)
 
-	var admissionReview admissionv1beta1.AdmissionReview
+	var admissionReview types.AdmissionReview
 	responder := &AdmissionResponder{}
-	deserializer := codec.UniversalDeserializer()
-	if _, _, err := deserializer.Decode(body, nil, &admissionReview); err != nil {
+	if err := json.Unmarshal(body, &admissionReview); err != nil {
 		responder.ToAdmissionResponse(fmt.Errorf("bad request, unable to decode admission review body: %v", err))
+		responder.Write(w, decodeReviewHeader(body))
+		return
+	}
+	switch admissionReview.APIVersion {
+	case types.AdmissionV1beta1, types.AdmissionV1:
+	case "":
+		// Reviews without an apiVersion predate admission.k8s.io/v1, treat them as v1beta1
+	default:
+		responder.ToAdmissionResponse(fmt.Errorf("bad request, unsupported admission review version %q", admissionReview.APIVersion))
 		responder.Write(w, admissionReview)
 		return
 	}
@@ -75,45 +129,147 @@ func (s *Server) HandleAdmissionRequest(w http.ResponseWriter, r *http.Request)
 		responder.Write(w, admissionReview)
 		return
 	}
+	start := time.Now()
 	admissionResponse := s.controller.Admit(admissionReview.Request)
+	observeAdmission(admissionReview.Request, admissionResponse, start)
 	w.Write(reviewResponseToByte(admissionResponse, admissionReview))
 }
 
-// Run starts the server
-func (s *Server) Run() {
-	flag.Parse()
-	// TODO: Use mutual tls after we agree on what cert the apiserver should use.
-	// glog.Info("Creating TLS config...")
-	// cert := getAPIServerCert(clientset)
-	// apiserverCA := x509.NewCertPool()
-	// apiserverCA.AppendCertsFromPEM(cert)
-	certs, err := tls.X509KeyPair(s.serverCert, s.serverKey)
-	if err != nil {
-		panic(fmt.Sprintf("unable to load certs: %v", err))
+// observeAdmission records the decision and latency of an admission
+func observeAdmission(request *types.AdmissionRequest, response *types.AdmissionResponse, start time.Time) {
+	decision := "denied"
+	if response != nil && response.Allowed {
+		decision = "allowed"
+	}
+	metrics.Admissions.WithLabelValues(decision, request.Namespace, request.Kind.Kind).Inc()
+	metrics.AdmissionDuration.WithLabelValues(decision).Observe(time.Since(start).Seconds())
+}
+
+// AddReadinessCheck adds a check that must pass before /readyz reports the server ready
+func (s *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.readinessChecksMutex.Lock()
+	defer s.readinessChecksMutex.Unlock()
+	s.readinessChecks = append(s.readinessChecks, readinessCheck{name: name, check: check})
+}
+
+// MarkShuttingDown makes /readyz report not ready so that the api server stops routing admissions to this server
+func (s *Server) MarkShuttingDown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
+// HandleHealthz reports that the process is alive
+func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// HandleReadyz reports whether the server is ready to handle admissions
+// It is not ready until the serving certificate is loaded and all readiness checks pass, and once it is shutting down
+func (s *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	failures := []string{}
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		failures = append(failures, "shutting down")
+	}
+	if s.getCertificate() == nil {
+		failures = append(failures, "certificate: not loaded")
+	}
+	s.readinessChecksMutex.RLock()
+	for _, c := range s.readinessChecks {
+		if err := c.check(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+		}
+	}
+	s.readinessChecksMutex.RUnlock()
+
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Join(failures, "\n")))
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// Run starts the server and blocks until stopCh is closed or the server fails
+// When stopCh is closed the server reports not ready, waits for the shutdown delay,
+// then stops accepting connections and waits up to the grace period for in-flight admissions to complete
+func (s *Server) Run(stopCh <-chan struct{}) error {
+	if s.getCertificate() == nil {
+		if err := s.SetCertificate(s.serverCert, s.serverKey); err != nil {
+			return fmt.Errorf("unable to load certs: %v", err)
+		}
 	}
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{certs},
-		// TODO: Use mutual tls after we agree on what cert the apiserver should use.
-		// ClientAuth determines the server's policy for TLS Client Authentication. The default is NoClientCert.
-		// ClientCAs:    apiserverCA,
-		// ClientAuth:   tls.RequireAndVerifyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.getCertificate(), nil
+		},
 		ClientAuth: tls.NoClientCert,
 	}
-	s.mux.HandleFunc("/admit", s.HandleAdmissionRequest)
-	port := "8000"
+	admit := http.Handler(http.HandlerFunc(s.HandleAdmissionRequest))
+	if s.clientCA != nil {
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(s.clientCA) {
+			return errors.New("unable to load client CA bundle, no certificates found")
+		}
+		// Client certificates are verified if they are presented so that probes without a certificate can reach /healthz and /readyz,
+		// admissions are rejected unless a verified certificate was presented
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		admit = s.requireClientCertificate(admit)
+	}
+	s.mux.Handle("/admit", admit)
+	s.mux.Handle("/metrics", promhttp.Handler())
+	s.mux.HandleFunc("/healthz", s.HandleHealthz)
+	s.mux.HandleFunc("/readyz", s.HandleReadyz)
 	server := &http.Server{
-		Addr:      fmt.Sprintf(":%s", port),
-		Handler:   s.mux,
-		TLSConfig: tlsConfig,
+		Addr:         s.addr,
+		Handler:      s.mux,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  s.readTimeout,
+		WriteTimeout: s.writeTimeout,
+		IdleTimeout:  s.idleTimeout,
+	}
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %v", s.addr, err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		glog.Infof("Starting %v Webhook on %s...", s.name, s.addr)
+		errCh <- server.ServeTLS(listener, "", "")
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-stopCh:
+	}
+
+	glog.Infof("Shutting down %v Webhook...", s.name)
+	s.MarkShuttingDown()
+	time.Sleep(s.shutdownDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownGracePeriod)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("unable to shut down gracefully: %v", err)
+	}
+	if err := <-errCh; err != http.ErrServerClosed {
+		return err
 	}
-	glog.Infof("Starting %v Webhook on port %s...", s.name, port)
-	server.ListenAndServeTLS("", "")
+	glog.Infof("%v Webhook stopped", s.name)
+	return nil
 }
 
-func reviewResponseToByte(admissionResponse *admissionv1beta1.AdmissionResponse, admissionReview admissionv1beta1.AdmissionReview) []byte {
-	response := admissionv1beta1.AdmissionReview{}
+// reviewResponseToByte builds the AdmissionReview returned to the api server
+// The response is returned with the same apiVersion and kind as the request, v1 requires the response UID to match the request UID
+func reviewResponseToByte(admissionResponse *types.AdmissionResponse, admissionReview types.AdmissionReview) []byte {
+	response := types.AdmissionReview{
+		TypeMeta: admissionReview.TypeMeta,
+	}
 	if admissionResponse != nil {
 		response.Response = admissionResponse
+		if admissionReview.APIVersion != types.AdmissionV1 {
+			warningsToAuditAnnotations(response.Response)
+		}
 		if admissionReview.Request != nil {
 			response.Response.UID = admissionReview.Request.UID
 			// reset the Object and OldObject, they are not needed in a response.
@@ -127,7 +283,42 @@ func reviewResponseToByte(admissionResponse *admissionv1beta1.AdmissionResponse,
 		glog.Error(err)
 		responder := &AdmissionResponder{}
 		responder.ToAdmissionResponse(fmt.Errorf("bad request, unable to decode admission review body: %v", err))
-		resp = reviewResponseToByte(responder.Flush(), response)
+		resp = reviewResponseToByte(responder.Flush(), admissionReview)
 	}
 	return resp
 }
+
+// decodeReviewHeader decodes the apiVersion, kind and request UID of an AdmissionReview that could not be decoded in full
+// so that the error response can still be matched to the request
+func decodeReviewHeader(body []byte) types.AdmissionReview {
+	var header struct {
+		metav1.TypeMeta `json:",inline"`
+		Request         *struct {
+			UID k8stypes.UID `json:"uid"`
+		} `json:"request,omitempty"`
+	}
+	var admissionReview types.AdmissionReview
+	if err := json.Unmarshal(body, &header); err != nil {
+		return admissionReview
+	}
+	admissionReview.TypeMeta = header.TypeMeta
+	if header.Request != nil {
+		admissionReview.Request = &types.AdmissionRequest{UID: header.Request.UID}
+	}
+	return admissionReview
+}
+
+// warningsToAuditAnnotations moves the warnings of the response to audit annotations warning-1, warning-2...
+// admission.k8s.io/v1beta1 api servers do not return warnings to the user, but the annotations are kept in the audit log
+func warningsToAuditAnnotations(admissionResponse *types.AdmissionResponse) {
+	if len(admissionResponse.Warnings) == 0 {
+		return
+	}
+	if admissionResponse.AuditAnnotations == nil {
+		admissionResponse.AuditAnnotations = map[string]string{}
+	}
+	for i, warning := range admissionResponse.Warnings {
+		admissionResponse.AuditAnnotations[fmt.Sprintf("warning-%d", i+1)] = warning
+	}
+	admissionResponse.Warnings = nil
+}
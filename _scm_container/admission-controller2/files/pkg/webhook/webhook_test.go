@@ -17,18 +17,29 @@ package webhook
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	fakeController "admission-controller2/pkg/controller/fakecontroller"
-	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"admission-controller2/pkg/metrics"
+	"admission-controller2/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+var (
+	v1beta1TypeMeta = metav1.TypeMeta{APIVersion: types.AdmissionV1beta1, Kind: "AdmissionReview"}
+	v1TypeMeta      = metav1.TypeMeta{APIVersion: types.AdmissionV1, Kind: "AdmissionReview"}
+	jsonPatchType   = types.PatchTypeJSONPatch
+)
+
 func getTestWebhookServer() *Server {
 	return &Server{
 		name:       "test",
@@ -40,20 +51,69 @@ func TestServer_HandleAdmissionRequest(t *testing.T) {
 
 	tests := []struct {
 		name            string
-		admissionReview admissionv1beta1.AdmissionReview
+		admissionReview types.AdmissionReview
 		allowed         bool
+		wantTypeMeta    metav1.TypeMeta
+		wantUID         string
 	}{
 		{
 			name: "Calls controller admit with admissionRequest from http request",
-			admissionReview: admissionv1beta1.AdmissionReview{
-				Request: &admissionv1beta1.AdmissionRequest{UID: "requestUID"},
+			admissionReview: types.AdmissionReview{
+				Request: &types.AdmissionRequest{UID: "requestUID"},
 			},
 			allowed: true,
+			wantUID: "requestUID",
 		},
 		{
 			name:    "Returns reject if http request doesn't contain an admissionRequest",
 			allowed: false,
 		},
+		{
+			name: "Calls controller admit with a v1beta1 admissionRequest and responds with v1beta1",
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1beta1TypeMeta,
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			allowed:      true,
+			wantTypeMeta: v1beta1TypeMeta,
+			wantUID:      "requestUID",
+		},
+		{
+			name: "Calls controller admit with a v1 admissionRequest and responds with v1",
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			allowed:      true,
+			wantTypeMeta: v1TypeMeta,
+			wantUID:      "requestUID",
+		},
+		{
+			name: "Returns reject if a v1beta1 http request doesn't contain an admissionRequest",
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1beta1TypeMeta,
+			},
+			allowed:      false,
+			wantTypeMeta: v1beta1TypeMeta,
+		},
+		{
+			name: "Returns reject if a v1 http request doesn't contain an admissionRequest",
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+			},
+			allowed:      false,
+			wantTypeMeta: v1TypeMeta,
+		},
+		{
+			name: "Returns reject if the admission review version is not supported",
+			admissionReview: types.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v2", Kind: "AdmissionReview"},
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			allowed:      false,
+			wantTypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v2", Kind: "AdmissionReview"},
+			wantUID:      "requestUID",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -64,52 +124,237 @@ func TestServer_HandleAdmissionRequest(t *testing.T) {
 			handler := http.HandlerFunc(server.HandleAdmissionRequest)
 			handler.ServeHTTP(rr, req)
 
-			var reviewOut admissionv1beta1.AdmissionReview
+			var reviewOut types.AdmissionReview
 			bytesOut, _ := ioutil.ReadAll(rr.Body)
 			json.Unmarshal(bytesOut, &reviewOut)
 			assert.Equal(t, tt.allowed, reviewOut.Response.Allowed)
+			assert.Equal(t, tt.wantTypeMeta, reviewOut.TypeMeta)
+			assert.Equal(t, tt.wantUID, string(reviewOut.Response.UID))
 		})
 	}
 }
 
+func TestServer_HandleAdmissionRequest_DecodeError(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantTypeMeta metav1.TypeMeta
+		wantUID      string
+	}{
+		{
+			name:         "Echoes the apiVersion and UID of a review that cannot be decoded",
+			body:         `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"requestUID","operation":5}}`,
+			wantTypeMeta: v1TypeMeta,
+			wantUID:      "requestUID",
+		},
+		{
+			name: "Rejects a body that is not JSON",
+			body: `not json`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := getTestWebhookServer()
+			req, _ := http.NewRequest("POST", "", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(server.HandleAdmissionRequest)
+			handler.ServeHTTP(rr, req)
+
+			var reviewOut types.AdmissionReview
+			bytesOut, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(bytesOut, &reviewOut)
+			assert.False(t, reviewOut.Response.Allowed)
+			assert.Equal(t, tt.wantTypeMeta, reviewOut.TypeMeta)
+			assert.Equal(t, tt.wantUID, string(reviewOut.Response.UID))
+		})
+	}
+}
+
+func TestServer_HandleAdmissionRequest_Metrics(t *testing.T) {
+	server := getTestWebhookServer()
+	admissions := metrics.Admissions.WithLabelValues("allowed", "metrics-test", "Pod")
+	before := testutil.ToFloat64(admissions)
+
+	bytesIn, _ := json.Marshal(types.AdmissionReview{
+		TypeMeta: v1TypeMeta,
+		Request: &types.AdmissionRequest{
+			UID:       "requestUID",
+			Namespace: "metrics-test",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		},
+	})
+	req, _ := http.NewRequest("POST", "", bytes.NewBuffer(bytesIn))
+	server.HandleAdmissionRequest(httptest.NewRecorder(), req)
+
+	assert.Equal(t, before+1, testutil.ToFloat64(admissions))
+}
+
 func Test_reviewResponseToByte(t *testing.T) {
 	tests := []struct {
 		name                string
-		admissionResponse   *admissionv1beta1.AdmissionResponse
-		admissionReview     admissionv1beta1.AdmissionReview
-		wantAdmissionReview admissionv1beta1.AdmissionReview
+		admissionResponse   *types.AdmissionResponse
+		admissionReview     types.AdmissionReview
+		wantAdmissionReview types.AdmissionReview
 	}{
 		{
 			name:              "Review response matches inputted review with matching request/response UID",
-			admissionResponse: &admissionv1beta1.AdmissionResponse{UID: "responseUID", Allowed: true},
-			admissionReview: admissionv1beta1.AdmissionReview{
-				Request: &admissionv1beta1.AdmissionRequest{UID: "requestUID"},
+			admissionResponse: &types.AdmissionResponse{UID: "responseUID", Allowed: true},
+			admissionReview: types.AdmissionReview{
+				Request: &types.AdmissionRequest{UID: "requestUID"},
 			},
-			wantAdmissionReview: admissionv1beta1.AdmissionReview{
-				Response: &admissionv1beta1.AdmissionResponse{UID: "requestUID", Allowed: true},
+			wantAdmissionReview: types.AdmissionReview{
+				Response: &types.AdmissionResponse{UID: "requestUID", Allowed: true},
 			},
 		},
 		{
 			name:              "Review response object and oldobject are reset",
-			admissionResponse: &admissionv1beta1.AdmissionResponse{},
-			admissionReview: admissionv1beta1.AdmissionReview{
-				Request: &admissionv1beta1.AdmissionRequest{
+			admissionResponse: &types.AdmissionResponse{},
+			admissionReview: types.AdmissionReview{
+				Request: &types.AdmissionRequest{
 					UID:       "requestUID",
 					Object:    runtime.RawExtension{Raw: []byte("SomeBytes")},
 					OldObject: runtime.RawExtension{Raw: []byte("SomeBytes")},
 				},
 			},
-			wantAdmissionReview: admissionv1beta1.AdmissionReview{
-				Response: &admissionv1beta1.AdmissionResponse{UID: "requestUID"},
+			wantAdmissionReview: types.AdmissionReview{
+				Response: &types.AdmissionResponse{UID: "requestUID"},
+			},
+		},
+		{
+			name:              "v1beta1 review response has the v1beta1 apiVersion and kind",
+			admissionResponse: &types.AdmissionResponse{UID: "responseUID", Allowed: true},
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1beta1TypeMeta,
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			wantAdmissionReview: types.AdmissionReview{
+				TypeMeta: v1beta1TypeMeta,
+				Response: &types.AdmissionResponse{UID: "requestUID", Allowed: true},
+			},
+		},
+		{
+			name:              "v1 review response has the v1 apiVersion and kind and the request UID",
+			admissionResponse: &types.AdmissionResponse{UID: "responseUID", Allowed: true},
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			wantAdmissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+				Response: &types.AdmissionResponse{UID: "requestUID", Allowed: true},
+			},
+		},
+		{
+			name:              "v1 review response keeps the patch and patch type",
+			admissionResponse: &types.AdmissionResponse{Allowed: true, Patch: []byte("[]"), PatchType: &jsonPatchType},
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			wantAdmissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+				Response: &types.AdmissionResponse{UID: "requestUID", Allowed: true, Patch: []byte("[]"), PatchType: &jsonPatchType},
+			},
+		},
+		{
+			name:              "v1 review response keeps the warnings",
+			admissionResponse: &types.AdmissionResponse{Allowed: true, Warnings: []string{"first", "second"}},
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			wantAdmissionReview: types.AdmissionReview{
+				TypeMeta: v1TypeMeta,
+				Response: &types.AdmissionResponse{UID: "requestUID", Allowed: true, Warnings: []string{"first", "second"}},
+			},
+		},
+		{
+			name: "v1beta1 review response returns the warnings as audit annotations",
+			admissionResponse: &types.AdmissionResponse{
+				Allowed:          true,
+				Warnings:         []string{"first", "second"},
+				AuditAnnotations: map[string]string{"digest": "sha256:abc"},
+			},
+			admissionReview: types.AdmissionReview{
+				TypeMeta: v1beta1TypeMeta,
+				Request:  &types.AdmissionRequest{UID: "requestUID"},
+			},
+			wantAdmissionReview: types.AdmissionReview{
+				TypeMeta: v1beta1TypeMeta,
+				Response: &types.AdmissionResponse{
+					UID:              "requestUID",
+					Allowed:          true,
+					AuditAnnotations: map[string]string{"digest": "sha256:abc", "warning-1": "first", "warning-2": "second"},
+				},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			bytes := reviewResponseToByte(tt.admissionResponse, tt.admissionReview)
-			var review admissionv1beta1.AdmissionReview
+			var review types.AdmissionReview
 			json.Unmarshal(bytes, &review)
 			assert.Equal(t, tt.wantAdmissionReview, review)
 		})
 	}
 }
+
+func TestServer_HandleHealthz(t *testing.T) {
+	server := getTestWebhookServer()
+	rr := httptest.NewRecorder()
+	server.HandleHealthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestServer_HandleReadyz(t *testing.T) {
+	tests := []struct {
+		name         string
+		certLoaded   bool
+		shuttingDown bool
+		checkErr     error
+		wantCode     int
+		wantBody     string
+	}{
+		{
+			name:       "Reports ready when the certificate is loaded and checks pass",
+			certLoaded: true,
+			wantCode:   http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:     "Reports not ready until the certificate is loaded",
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "certificate: not loaded",
+		},
+		{
+			name:       "Reports not ready when a check fails",
+			certLoaded: true,
+			checkErr:   errors.New("not synced"),
+			wantCode:   http.StatusServiceUnavailable,
+			wantBody:   "policy: not synced",
+		},
+		{
+			name:         "Reports not ready when shutting down",
+			certLoaded:   true,
+			shuttingDown: true,
+			wantCode:     http.StatusServiceUnavailable,
+			wantBody:     "shutting down",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := getTestWebhookServer()
+			if tt.certLoaded {
+				require.NoError(t, server.SetCertificate(generateTestCert(t, "webhook", nil)))
+			}
+			if tt.shuttingDown {
+				server.MarkShuttingDown()
+			}
+			server.AddReadinessCheck("policy", func() error { return tt.checkErr })
+			rr := httptest.NewRecorder()
+			server.HandleReadyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Portieris Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// AdmissionV1beta1 is the apiVersion of an admission.k8s.io/v1beta1 AdmissionReview
+	AdmissionV1beta1 = "admission.k8s.io/v1beta1"
+	// AdmissionV1 is the apiVersion of an admission.k8s.io/v1 AdmissionReview
+	AdmissionV1 = "admission.k8s.io/v1"
+)
+
+// AdmissionReview is a version independent AdmissionReview.
+// The admission.k8s.io v1beta1 and v1 AdmissionReviews share the same wire format, the apiVersion
+// in TypeMeta records which version was sent so that the response can be returned in the same version.
+type AdmissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *AdmissionRequest  `json:"request,omitempty"`
+	Response        *AdmissionResponse `json:"response,omitempty"`
+}
+
+// AdmissionRequest is a version independent AdmissionRequest
+type AdmissionRequest struct {
+	UID         k8stypes.UID                `json:"uid"`
+	Kind        metav1.GroupVersionKind     `json:"kind"`
+	Resource    metav1.GroupVersionResource `json:"resource"`
+	SubResource string                      `json:"subResource,omitempty"`
+	Name        string                      `json:"name,omitempty"`
+	Namespace   string                      `json:"namespace,omitempty"`
+	Operation   string                      `json:"operation"`
+	UserInfo    authenticationv1.UserInfo   `json:"userInfo"`
+	Object      runtime.RawExtension        `json:"object,omitempty"`
+	OldObject   runtime.RawExtension        `json:"oldObject,omitempty"`
+	DryRun      *bool                       `json:"dryRun,omitempty"`
+}
+
+// PatchType is the type of patch being returned in an AdmissionResponse
+type PatchType string
+
+// PatchTypeJSONPatch is the only PatchType supported by the admission API
+const PatchTypeJSONPatch PatchType = "JSONPatch"
+
+// AdmissionResponse is a version independent AdmissionResponse
+type AdmissionResponse struct {
+	UID              k8stypes.UID      `json:"uid"`
+	Allowed          bool              `json:"allowed"`
+	Result           *metav1.Status    `json:"status,omitempty"`
+	Patch            []byte            `json:"patch,omitempty"`
+	PatchType        *PatchType        `json:"patchType,omitempty"`
+	AuditAnnotations map[string]string `json:"auditAnnotations,omitempty"`
+	// Warnings are shown to the user whether or not the request is allowed
+	Warnings []string `json:"warnings,omitempty"`
+}